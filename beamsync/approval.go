@@ -0,0 +1,363 @@
+package beamsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Approvals holds incoming transfers until the desktop accepts or declines
+// them. The upload page announces a batch on /request and waits; once the
+// user accepts, the returned token lets the batch through /upload and tus.
+// Uploads that skip /request are paused on arrival instead.
+// A nil *Approvals accepts everything.
+type Approvals struct {
+	timeout time.Duration
+	closed  chan struct{}
+	once    sync.Once
+
+	mu         sync.Mutex
+	pending    map[string]chan bool
+	grants     map[string]*grant
+	autoAccept AutoAcceptRules
+}
+
+// AutoAcceptRules let some transfers through without asking. A transfer is
+// accepted if it comes from one of IPs, or if its announced size is known
+// and at most MaxBytes. The zero value asks about everything. Either way a
+// file announced on /request is cut off with 413 if it outgrows its size.
+type AutoAcceptRules struct {
+	IPs      []string `json:"ips"`
+	MaxBytes int64    `json:"maxBytes"`
+}
+
+// grant is what an accepted /request lets through: each name once, at
+// most its announced size (-1 if unknown), until it expires. It outlives
+// the approval timeout because a page may upload a large batch one file
+// at a time.
+type grant struct {
+	sizes   map[string]int64
+	expires time.Time
+}
+
+// grantTTL is how long an accepted batch may take to arrive.
+const grantTTL = time.Hour
+
+// IncomingFile is one entry of a transfer awaiting approval.
+type IncomingFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+const (
+	approvalHeader = "BeamSync-Approval"
+	maxRequestBody = 1 << 20
+)
+
+var (
+	errDeclined        = errors.New("transfer declined")
+	errApprovalTimeout = errors.New("approval timed out")
+	errApprovalsClosed = errors.New("server shutting down")
+	errExceedsApproval = errors.New("file is larger than approved")
+)
+
+// NewApprovals creates an approval queue; unanswered requests are declined
+// after timeout.
+func NewApprovals(timeout time.Duration) *Approvals {
+	return &Approvals{
+		timeout: timeout,
+		closed:  make(chan struct{}),
+		pending: make(map[string]chan bool),
+		grants:  make(map[string]*grant),
+	}
+}
+
+// Respond accepts or declines a pending request. It reports false if the
+// request already timed out or was withdrawn.
+func (a *Approvals) Respond(id string, accept bool) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	decision, ok := a.pending[id]
+	delete(a.pending, id)
+	a.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	decision <- accept
+	return true
+}
+
+// SetAutoAccept replaces the auto-accept rules; requests already waiting
+// still wait for an answer.
+func (a *Approvals) SetAutoAccept(rules AutoAcceptRules) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.autoAccept = rules
+	a.mu.Unlock()
+}
+
+// autoAccepts reports whether the rules let files from r through unasked.
+func (a *Approvals) autoAccepts(r *http.Request, files []IncomingFile) bool {
+	a.mu.Lock()
+	rules := a.autoAccept
+	a.mu.Unlock()
+
+	ip := clientIP(r)
+	for _, trusted := range rules.IPs {
+		if trusted == ip {
+			return true
+		}
+	}
+	if rules.MaxBytes <= 0 {
+		return false
+	}
+	var total int64
+	for _, f := range files {
+		if f.Size < 0 {
+			return false
+		}
+		total += f.Size
+	}
+	return total <= rules.MaxBytes
+}
+
+// ask emits incoming_request and blocks until the desktop answers, the
+// timeout expires or the client goes away; files the auto-accept rules
+// cover go straight through. It returns nil once the files are accepted.
+func (a *Approvals) ask(r *http.Request, files []IncomingFile) error {
+	if a == nil {
+		return nil
+	}
+	if a.autoAccepts(r, files) {
+		fmt.Printf("✅ Auto-accepted %d file(s) from %s\n", len(files), clientIP(r))
+		return nil
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	decision := make(chan bool, 1)
+	a.mu.Lock()
+	a.pending[id] = decision
+	a.mu.Unlock()
+
+	fmt.Printf("✋ Waiting for approval of %d file(s) from %s\n", len(files), clientIP(r))
+	eventsFor(r).emit(IncomingRequest{ID: id, Device: deviceName(r), Files: files})
+
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+
+	select {
+	case accept := <-decision:
+		if !accept {
+			fmt.Println("🚫 Transfer declined")
+			return errDeclined
+		}
+	case <-timer.C:
+		a.withdraw(r, id, "timeout")
+		return errApprovalTimeout
+	case <-r.Context().Done():
+		a.withdraw(r, id, "cancelled")
+		return r.Context().Err()
+	case <-a.closed:
+		a.withdraw(r, id, "shutdown")
+		return errApprovalsClosed
+	}
+
+	fmt.Println("✅ Transfer approved")
+	return nil
+}
+
+// grant issues a token letting each of files through once, and drops
+// tokens that expired unused. Without approvals no token is needed.
+func (a *Approvals) grant(files []IncomingFile) (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	g := &grant{sizes: make(map[string]int64, len(files)), expires: time.Now().Add(grantTTL)}
+	for _, f := range files {
+		size := f.Size
+		if size < 0 {
+			size = -1
+		}
+		g.sizes[f.Name] = size
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for t, old := range a.grants {
+		if time.Now().After(old.expires) {
+			delete(a.grants, t)
+		}
+	}
+	a.grants[token] = g
+	return token, nil
+}
+
+// Close declines every pending request; the server calls it on shutdown.
+func (a *Approvals) Close() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() { close(a.closed) })
+}
+
+// withdraw drops an unanswered request and tells the desktop to close its
+// prompt.
+func (a *Approvals) withdraw(r *http.Request, id, reason string) {
+	a.mu.Lock()
+	_, ok := a.pending[id]
+	delete(a.pending, id)
+	a.mu.Unlock()
+
+	if ok {
+		fmt.Printf("⌛ Approval request %s closed: %s\n", id, reason)
+		eventsFor(r).emit(IncomingRequestClosed{ID: id, Reason: reason})
+	}
+}
+
+// claim uses up name from the request's token, reporting whether it was
+// there and the size it was granted at, -1 if unlimited; the token goes
+// once it is empty or expired. Without approvals everything is let
+// through.
+func (a *Approvals) claim(r *http.Request, name string) (int64, bool) {
+	if a == nil {
+		return -1, true
+	}
+	token := r.Header.Get(approvalHeader)
+	if token == "" {
+		return -1, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.grants[token]
+	if !ok {
+		return -1, false
+	}
+	if time.Now().After(g.expires) {
+		delete(a.grants, token)
+		return -1, false
+	}
+	size, ok := g.sizes[name]
+	if !ok {
+		return -1, false
+	}
+	delete(g.sizes, name)
+	if len(g.sizes) == 0 {
+		delete(a.grants, token)
+	}
+	return size, true
+}
+
+// authorize lets an upload through if it was approved beforehand, otherwise
+// it pauses the request until the desktop decides. It returns the most the
+// file may hold, -1 if unlimited. On refusal the error response has
+// already been written.
+func (a *Approvals) authorize(w http.ResponseWriter, r *http.Request, file IncomingFile) (int64, bool) {
+	if size, ok := a.claim(r, file.Name); ok {
+		return size, true
+	}
+	if err := a.ask(r, []IncomingFile{file}); err != nil {
+		writeApprovalError(w, err)
+		return -1, false
+	}
+	return file.Size, true
+}
+
+// limitApproved fails reads with errExceedsApproval once more than n bytes
+// come through r; a negative n lets everything through.
+func limitApproved(r io.Reader, n int64) io.Reader {
+	if n < 0 {
+		return r
+	}
+	return &approvedReader{r: r, remaining: n}
+}
+
+type approvedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *approvedReader) Read(p []byte) (int, error) {
+	// Ask for one byte more than allowed to tell "exactly n" from "more"
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		return n, errExceedsApproval
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// requestHandler serves POST /request, where the upload page lists the
+// files it is about to send and waits for the desktop's answer.
+func (a *Approvals) requestHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Files []IncomingFile `json:"files"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&body); err != nil || len(body.Files) == 0 {
+			http.Error(w, "Invalid transfer request", http.StatusBadRequest)
+			return
+		}
+		for i, f := range body.Files {
+			name, err := cleanRelativePath(f.Name)
+			if err != nil || name == "" {
+				http.Error(w, "Invalid file path", http.StatusBadRequest)
+				return
+			}
+			body.Files[i].Name = name
+		}
+
+		if err := a.ask(r, body.Files); err != nil {
+			writeApprovalError(w, err)
+			return
+		}
+		token, err := a.grant(body.Files)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}
+}
+
+func writeApprovalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDeclined):
+		http.Error(w, "Transfer declined", http.StatusForbidden)
+	case errors.Is(err, errApprovalTimeout):
+		http.Error(w, "Approval timed out", http.StatusRequestTimeout)
+	case errors.Is(err, errApprovalsClosed):
+		http.Error(w, "BeamSync is shutting down", http.StatusServiceUnavailable)
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody is listening for a response
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,260 @@
+package beamsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// approvalRequest returns a request from 192.0.2.1 whose events go to the
+// returned channel.
+func approvalRequest(t *testing.T) (*http.Request, <-chan Event) {
+	t.Helper()
+	em := newEmitter("test")
+	events := make(chan Event, 10)
+	sub := em.bus.subscribe(func(_ string, e Event) { events <- e }, SubscribeOptions{})
+	t.Cleanup(sub.Close)
+	r := httptest.NewRequest(http.MethodPost, "/request", nil)
+	return r.WithContext(withEmitter(r.Context(), em)), events
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return nil
+	}
+}
+
+func TestApprovalAutoAccept(t *testing.T) {
+	small := []IncomingFile{{Name: "a.txt", Size: 600}, {Name: "b.txt", Size: 400}}
+	unknown := []IncomingFile{{Name: "a.txt", Size: 10}, {Name: "b.txt", Size: -1}}
+	for _, c := range []struct {
+		name  string
+		rules AutoAcceptRules
+		files []IncomingFile
+		want  bool
+	}{
+		{"no rules", AutoAcceptRules{}, small, false},
+		{"trusted address", AutoAcceptRules{IPs: []string{"192.0.2.1"}}, unknown, true},
+		{"other address", AutoAcceptRules{IPs: []string{"192.0.2.9"}}, small, false},
+		{"total at the limit", AutoAcceptRules{MaxBytes: 1000}, small, true},
+		{"total over the limit", AutoAcceptRules{MaxBytes: 999}, small, false},
+		{"unknown size", AutoAcceptRules{MaxBytes: 1 << 30}, unknown, false},
+	} {
+		a := NewApprovals(time.Minute)
+		a.SetAutoAccept(c.rules)
+		r, _ := approvalRequest(t)
+		if got := a.autoAccepts(r, c.files); got != c.want {
+			t.Errorf("%s: autoAccepts = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// Auto-accepted files never wait for an answer
+	a := NewApprovals(time.Minute)
+	a.SetAutoAccept(AutoAcceptRules{MaxBytes: 1000})
+	r, _ := approvalRequest(t)
+	if err := a.ask(r, small); err != nil {
+		t.Errorf("auto-accepted ask: %v", err)
+	}
+}
+
+func TestApprovalAskRespond(t *testing.T) {
+	for _, accept := range []bool{true, false} {
+		a := NewApprovals(time.Minute)
+		r, events := approvalRequest(t)
+		result := make(chan error, 1)
+		go func() { result <- a.ask(r, []IncomingFile{{Name: "a.txt", Size: 1}}) }()
+
+		req, ok := nextEvent(t, events).(IncomingRequest)
+		if !ok || len(req.Files) != 1 || req.Files[0].Name != "a.txt" {
+			t.Fatalf("announced %+v", req)
+		}
+		if !a.Respond(req.ID, accept) {
+			t.Fatal("Respond found no pending request")
+		}
+		err := <-result
+		if accept && err != nil {
+			t.Errorf("accepted ask: %v", err)
+		}
+		if !accept && !errors.Is(err, errDeclined) {
+			t.Errorf("declined ask: %v, want errDeclined", err)
+		}
+		if a.Respond(req.ID, accept) {
+			t.Error("answered the same request twice")
+		}
+	}
+}
+
+func TestApprovalAskWithdrawn(t *testing.T) {
+	for _, c := range []struct {
+		reason string
+		want   error
+	}{
+		{"timeout", errApprovalTimeout},
+		{"shutdown", errApprovalsClosed},
+	} {
+		timeout := time.Minute
+		if c.reason == "timeout" {
+			timeout = 10 * time.Millisecond
+		}
+		a := NewApprovals(timeout)
+		r, events := approvalRequest(t)
+		result := make(chan error, 1)
+		go func() { result <- a.ask(r, []IncomingFile{{Name: "a.txt", Size: 1}}) }()
+
+		req := nextEvent(t, events).(IncomingRequest)
+		if c.reason == "shutdown" {
+			a.Close()
+		}
+		if err := <-result; !errors.Is(err, c.want) {
+			t.Errorf("%s: ask returned %v, want %v", c.reason, err, c.want)
+		}
+		closed, ok := nextEvent(t, events).(IncomingRequestClosed)
+		if !ok || closed.ID != req.ID || closed.Reason != c.reason {
+			t.Errorf("%s: closed with %+v", c.reason, closed)
+		}
+		if a.Respond(req.ID, true) {
+			t.Errorf("%s: answered a withdrawn request", c.reason)
+		}
+	}
+}
+
+func TestApprovalGrantClaim(t *testing.T) {
+	a := NewApprovals(time.Minute)
+	token, err := a.grant([]IncomingFile{{Name: "a.txt", Size: 10}, {Name: "b.txt", Size: -5}})
+	if err != nil || token == "" {
+		t.Fatalf("grant = %q, %v", token, err)
+	}
+	claim := func(token, name string) (int64, bool) {
+		r := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		if token != "" {
+			r.Header.Set(approvalHeader, token)
+		}
+		return a.claim(r, name)
+	}
+
+	if _, ok := claim("", "a.txt"); ok {
+		t.Error("claimed without a token")
+	}
+	if _, ok := claim("bogus", "a.txt"); ok {
+		t.Error("claimed with an unknown token")
+	}
+	if _, ok := claim(token, "c.txt"); ok {
+		t.Error("claimed a name that wasn't granted")
+	}
+	if size, ok := claim(token, "a.txt"); !ok || size != 10 {
+		t.Errorf("claim a.txt = %d, %v; want 10, true", size, ok)
+	}
+	if _, ok := claim(token, "a.txt"); ok {
+		t.Error("claimed a.txt twice")
+	}
+	if size, ok := claim(token, "b.txt"); !ok || size != -1 {
+		t.Errorf("claim b.txt = %d, %v; want -1, true", size, ok)
+	}
+	if len(a.grants) != 0 {
+		t.Error("used-up token kept")
+	}
+
+	token, _ = a.grant([]IncomingFile{{Name: "a.txt", Size: 10}})
+	a.grants[token].expires = time.Now().Add(-time.Second)
+	if _, ok := claim(token, "a.txt"); ok {
+		t.Error("claimed from an expired token")
+	}
+	if len(a.grants) != 0 {
+		t.Error("expired token kept")
+	}
+
+	var none *Approvals
+	if token, err := none.grant([]IncomingFile{{Name: "a.txt"}}); token != "" || err != nil {
+		t.Errorf("nil grant = %q, %v", token, err)
+	}
+	if size, ok := none.claim(httptest.NewRequest(http.MethodPost, "/upload", nil), "a.txt"); !ok || size != -1 {
+		t.Errorf("nil claim = %d, %v; want -1, true", size, ok)
+	}
+}
+
+func TestLimitApproved(t *testing.T) {
+	for _, c := range []struct {
+		limit int64
+		size  int
+		fail  bool
+	}{
+		{5, 4, false},
+		{5, 5, false},
+		{5, 6, true},
+		{5, 100, true},
+		{0, 0, false},
+		{0, 1, true},
+		{-1, 100, false},
+	} {
+		data := bytes.Repeat([]byte("x"), c.size)
+		for _, small := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader(data)
+			if small {
+				r = iotest.OneByteReader(r)
+			}
+			got, err := io.ReadAll(limitApproved(r, c.limit))
+			if c.fail {
+				if !errors.Is(err, errExceedsApproval) || int64(len(got)) != c.limit {
+					t.Errorf("limit %d, %d bytes (one at a time: %v): read %d, %v; want %d, errExceedsApproval",
+						c.limit, c.size, small, len(got), err, c.limit)
+				}
+				continue
+			}
+			if err != nil || len(got) != c.size {
+				t.Errorf("limit %d, %d bytes (one at a time: %v): read %d, %v", c.limit, c.size, small, len(got), err)
+			}
+		}
+	}
+}
+
+func TestRequestHandler(t *testing.T) {
+	body := `{"files": [{"name": "photos/a.jpg", "size": 10}]}`
+	post := func(a *Approvals, body string) *httptest.ResponseRecorder {
+		r, _ := approvalRequest(t)
+		r.Body = io.NopCloser(strings.NewReader(body))
+		w := httptest.NewRecorder()
+		a.requestHandler()(w, r)
+		return w
+	}
+	token := func(w *httptest.ResponseRecorder) string {
+		var resp struct{ Token string }
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Token
+	}
+
+	if w := post(nil, body); w.Code != http.StatusOK || token(w) != "" {
+		t.Errorf("without approvals: status %d", w.Code)
+	}
+
+	a := NewApprovals(time.Minute)
+	a.SetAutoAccept(AutoAcceptRules{IPs: []string{"192.0.2.1"}})
+	w := post(a, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("auto-accepted: status %d", w.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	r.Header.Set(approvalHeader, token(w))
+	if size, ok := a.claim(r, "photos/a.jpg"); !ok || size != 10 {
+		t.Errorf("claim with the returned token = %d, %v", size, ok)
+	}
+
+	for _, bad := range []string{`{"files": []}`, `{"files": [{"name": "../a.jpg"}]}`, `nope`} {
+		if w := post(a, bad); w.Code != http.StatusBadRequest {
+			t.Errorf("request %s: status %d, want 400", bad, w.Code)
+		}
+	}
+}
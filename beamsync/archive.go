@@ -0,0 +1,120 @@
+package beamsync
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Shared directories are streamed as archives built while the client
+// downloads, so nothing is staged in a temp file first.
+
+// archiveFormat picks the archive type from ?format=, defaulting to zip.
+func archiveFormat(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case "tar.gz", "tgz":
+		return "tar.gz"
+	default:
+		return "zip"
+	}
+}
+
+// serveArchive streams dir as a zip or tar.gz download.
+func serveArchive(w http.ResponseWriter, r *http.Request, dir string) {
+	format := archiveFormat(r)
+	name := filepath.Base(dir)
+
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", name, format))
+
+	fmt.Printf("📦 Streaming %s as %s\n", dir, format)
+
+	if format == "zip" {
+		entries, err := zipEntriesFor(dir, name)
+		if err != nil {
+			http.Error(w, "Folder unavailable", http.StatusInternalServerError)
+			return
+		}
+		serveZip(w, r, entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	// Headers are long gone by now; the client sees a truncated archive
+	if err := streamTarGz(w, dir, name); err != nil {
+		fmt.Printf("❌ Archive stream for %s aborted: %v\n", dir, err)
+	}
+}
+
+// walkShared visits the directories and regular files under root. Symlinks
+// and special files are skipped so an archive never reaches outside root.
+func walkShared(root string, fn func(path, rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(p, filepath.ToSlash(rel), info)
+	})
+}
+
+// streamTarGz writes root as a gzip-compressed tar under prefix/.
+func streamTarGz(w io.Writer, root, prefix string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := walkShared(root, func(p, rel string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return copyFileTo(tw, p, info.Size())
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// copyFileTo copies exactly size bytes, the length already promised in the
+// archive header, even if the file changes while it is being streamed.
+func copyFileTo(dst io.Writer, p string, size int64) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(dst, f, size)
+	return err
+}
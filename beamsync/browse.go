@@ -0,0 +1,177 @@
+package beamsync
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// renderDownloadPage fills the {{FILES}} slot of the download UI.
+func renderDownloadPage(w http.ResponseWriter, files string) {
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Header().Set("Content-Type", "text/html")
+
+	content, err := uiFS.ReadFile("ui/download.html")
+	if err != nil {
+		http.Error(w, "UI Load Error", http.StatusInternalServerError)
+		return
+	}
+
+	page := strings.Replace(string(content), "{{FILES}}", files, 1)
+	w.Write([]byte(page))
+}
+
+// directoryCard is the entry for a shared folder on the main download page.
+func directoryCard(idx int, dir string) string {
+	return fmt.Sprintf(`<div class="file-card">
+					<div class="file-info">📁 %s/</div>
+					<a href="/browse/%d/" class="download-btn">📂 OPEN</a>
+					<a href="/download/%d?format=zip" class="download-btn">⬇️ ZIP</a>
+					<a href="/download/%d?format=tar.gz" class="download-btn">⬇️ TGZ</a>
+				</div>`, html.EscapeString(filepath.Base(dir)), idx, idx, idx)
+}
+
+// browseHandler serves /browse/{index}/{path...} for shared directories:
+// folders render as a listing, files download directly. A folder can also
+// be fetched as an archive with ?format=zip or ?format=tar.gz.
+func browseHandler(filePaths []string, isDir []bool, transfers *transferTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/browse/")
+		idxStr, rel, _ := strings.Cut(rest, "/")
+		idx, err := strconv.Atoi(idxStr)
+		if err != nil || idx < 0 || idx >= len(filePaths) || !isDir[idx] {
+			http.NotFound(w, r)
+			return
+		}
+
+		rel, err = cleanRelativePath(rel)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		root := filePaths[idx]
+		target, err := resolveShared(root, rel)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		info, err := os.Stat(target)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !info.IsDir() {
+			reportSent(transfers, info.Name(), target, &fileDigest{path: target}, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", info.Name()))
+				http.ServeFile(w, r, target)
+			})(w, r)
+			return
+		}
+
+		if r.URL.Query().Has("format") {
+			reportSent(transfers, info.Name()+"."+archiveFormat(r), target, nil, func(w http.ResponseWriter, r *http.Request) {
+				serveArchive(w, r, target)
+			})(w, r)
+			return
+		}
+
+		renderDownloadPage(w, directoryListing(idx, root, rel, target))
+	}
+}
+
+// resolveShared joins rel onto a shared root and refuses anything that
+// resolves outside it, including through symlinks.
+func resolveShared(root, rel string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", err
+	}
+	if !insideRoot(realRoot, target) {
+		return "", errUnsafePath
+	}
+	return target, nil
+}
+
+func directoryListing(idx int, root, rel, dir string) string {
+	base := fmt.Sprintf("/browse/%d/", idx)
+	here := base + escapePath(rel)
+	if rel != "" {
+		here += "/"
+	}
+
+	var builder strings.Builder
+	title := path.Join(filepath.Base(root), rel)
+	builder.WriteString(fmt.Sprintf(`<div class="file-card">
+				<div class="file-info">📂 %s/</div>
+				<a href="%s?format=zip" class="download-btn">⬇️ ZIP</a>
+				<a href="%s?format=tar.gz" class="download-btn">⬇️ TGZ</a>
+			</div>`, html.EscapeString(title), here, here))
+
+	up := "/"
+	if rel != "" {
+		up = base
+		if parent := path.Dir(rel); parent != "." {
+			up += escapePath(parent) + "/"
+		}
+	}
+	builder.WriteString(fmt.Sprintf(`<div class="file-card">
+				<div class="file-info">..</div>
+				<a href="%s" class="download-btn">⬆️ UP</a>
+			</div>`, up))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		builder.WriteString(`<div class="empty-msg">Folder unavailable</div>`)
+		return builder.String()
+	}
+
+	for _, entry := range entries {
+		name := html.EscapeString(entry.Name())
+		link := here + url.PathEscape(entry.Name())
+		switch {
+		case entry.IsDir():
+			builder.WriteString(fmt.Sprintf(`<div class="file-card">
+				<div class="file-info">📁 %s/</div>
+				<a href="%s/" class="download-btn">📂 OPEN</a>
+			</div>`, name, link))
+		case entry.Type().IsRegular():
+			builder.WriteString(fmt.Sprintf(`<div class="file-card">
+				<div class="file-info">%s</div>
+				<a href="%s" class="download-btn">⬇️ SAVE</a>
+			</div>`, name, link))
+		}
+	}
+
+	if len(entries) == 0 {
+		builder.WriteString(`<div class="empty-msg">Empty folder</div>`)
+	}
+	return builder.String()
+}
+
+// escapePath URL-escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,324 @@
+package beamsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerClient sends files to another BeamSync receiver through the same
+// /pair, /request and /upload endpoints the phone page uses.
+type PeerClient struct {
+	peer     Peer
+	http     *http.Client
+	clientID string // secret the peer knows this client by
+}
+
+var (
+	ErrPairingRequired  = errors.New("peer requires pairing")
+	ErrWrongPIN         = errors.New("pairing PIN rejected")
+	ErrTransferDeclined = errors.New("transfer declined by peer")
+	ErrApprovalTimeout  = errors.New("peer did not answer in time")
+)
+
+// NewPeerClient prepares a client for peer. Over HTTPS the peer's
+// certificate must match the fingerprint it advertised.
+func NewPeerClient(peer Peer) (*PeerClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if peer.Scheme == "https" {
+		if peer.Fingerprint == "" {
+			return nil, errors.New("peer advertises HTTPS without a fingerprint")
+		}
+		want := strings.ToLower(peer.Fingerprint)
+		transport.TLSClientConfig = &tls.Config{
+			// Self-signed; trust comes from the pinned fingerprint instead
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 {
+					return errors.New("peer sent no certificate")
+				}
+				sum := sha256.Sum256(rawCerts[0])
+				if hex.EncodeToString(sum[:]) != want {
+					return errors.New("peer certificate does not match its fingerprint")
+				}
+				return nil
+			},
+		}
+	}
+
+	clientID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return &PeerClient{
+		peer:     peer,
+		http:     &http.Client{Jar: jar, Transport: transport},
+		clientID: clientID,
+	}, nil
+}
+
+func (c *PeerClient) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.peer.URL()+p, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(clientHeader, c.clientID)
+	req.Header.Set("User-Agent", "BeamSync-Desktop ("+localHostname()+")")
+	return req, nil
+}
+
+// Pair signs in with the PIN shown on the peer. Peers without pairing
+// accept it as a no-op.
+func (c *PeerClient) Pair(ctx context.Context, pin string) error {
+	form := url.Values{"pin": {pin}}
+	req, err := c.newRequest(ctx, http.MethodPost, "/pair", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Look at the redirect itself: success and a wrong PIN both answer 303
+	client := *c.http
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusSeeOther:
+		if strings.Contains(resp.Header.Get("Location"), "error") {
+			return ErrWrongPIN
+		}
+		return nil
+	case http.StatusTooManyRequests:
+		return errors.New("too many wrong PINs, try again later")
+	case http.StatusNotFound:
+		// Without pairing the peer has no /pair endpoint
+		return nil
+	default:
+		return fmt.Errorf("pairing failed: %s", resp.Status)
+	}
+}
+
+// peerFile is one file to send and its path on the receiving side.
+type peerFile struct {
+	path    string
+	name    string
+	size    int64
+	modTime time.Time
+	sum     string // filled in as the file is sent
+}
+
+// Send uploads files and folders to the peer, waiting for its approval
+// first when it asks for one. Folders keep their structure. Once the peer
+// has everything, a FileSent event is raised for each file.
+func (c *PeerClient) Send(ctx context.Context, paths []string) error {
+	files, err := collectPeerFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("nothing to send")
+	}
+
+	token, err := c.requestApproval(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.CloseWithError(writePeerUpload(mw, files))
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/upload", pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set(approvalHeader, token)
+	}
+
+	fmt.Printf("🛰️ Sending %d file(s) to %s\n", len(files), c.peer.Name)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if err := peerResponseError(resp); err != nil {
+		return err
+	}
+
+	// The peer has read everything by now; closing only frees a writer
+	// stuck on a peer that answered early
+	pr.Close()
+	<-written
+	var events *emitter // not a server, so untagged
+	for _, f := range files {
+		events.emit(FileSent{Name: f.name, Path: f.path, Size: f.size, SHA256: f.sum, Device: c.peer.Name, StartedAt: started})
+	}
+	return nil
+}
+
+func (c *PeerClient) requestApproval(ctx context.Context, files []peerFile) (string, error) {
+	var body struct {
+		Files []IncomingFile `json:"files"`
+	}
+	for _, f := range files {
+		body.Files = append(body.Files, IncomingFile{Name: f.name, Size: f.size})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/request", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := peerResponseError(resp); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Token, nil
+}
+
+func peerResponseError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrPairingRequired
+	case http.StatusForbidden:
+		return ErrTransferDeclined
+	case http.StatusRequestTimeout:
+		return ErrApprovalTimeout
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == StatusChecksumMismatch {
+		return fmt.Errorf("peer reported corrupted files: %s", strings.TrimSpace(string(msg)))
+	}
+	return fmt.Errorf("peer refused upload: %s (%s)", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// writePeerUpload streams the multipart body: sha256 and lastModified
+// fields, then the file, for each file in turn.
+func writePeerUpload(mw *multipart.Writer, files []peerFile) error {
+	for i, f := range files {
+		sum, err := hashFile(f.path)
+		if err != nil {
+			return err
+		}
+		files[i].sum = sum
+		if err := mw.WriteField("sha256", sum); err != nil {
+			return err
+		}
+		if err := mw.WriteField("lastModified", strconv.FormatInt(f.modTime.UnixMilli(), 10)); err != nil {
+			return err
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", multipartFileDisposition(f.name))
+		header.Set("Content-Type", "application/octet-stream")
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		src, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		progress := newProgressReader(nil, src, f.name, 0, f.size)
+		_, err = io.Copy(part, progress)
+		src.Close()
+		if err != nil {
+			return err
+		}
+		progress.Finish()
+		fmt.Printf("📤 Sent %s\n", f.name)
+	}
+	return mw.Close()
+}
+
+// multipartFileDisposition keeps slashes in the filename so folders
+// survive; multipart.Writer.CreateFormFile would do the same but only
+// escapes quotes and backslashes, which we mirror here.
+func multipartFileDisposition(name string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name)
+	return fmt.Sprintf(`form-data; name="documents"; filename="%s"`, escaped)
+}
+
+// collectPeerFiles expands folders into their regular files, named
+// relative to the folder's parent so the peer recreates the folder.
+func collectPeerFiles(paths []string) ([]peerFile, error) {
+	var files []peerFile
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, peerFile{path: p, name: filepath.Base(p), size: info.Size(), modTime: info.ModTime()})
+			continue
+		}
+
+		base := filepath.Base(p)
+		err = walkShared(p, func(fp, rel string, fi fs.FileInfo) error {
+			if !fi.IsDir() {
+				files = append(files, peerFile{path: fp, name: path.Join(base, rel), size: fi.Size(), modTime: fi.ModTime()})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
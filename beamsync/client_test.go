@@ -0,0 +1,50 @@
+package beamsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPeerClientPairStatuses(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		status   int
+		location string
+		ok       bool
+		wrongPIN bool
+	}{
+		{"paired", http.StatusSeeOther, "/", true, false},
+		{"wrong PIN", http.StatusSeeOther, "/?error=1", false, true},
+		{"no pairing", http.StatusNotFound, "", true, false},
+		{"locked out", http.StatusTooManyRequests, "", false, false},
+		{"unauthorized", http.StatusUnauthorized, "", false, false},
+		{"server error", http.StatusInternalServerError, "", false, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.location != "" {
+				w.Header().Set("Location", c.location)
+			}
+			w.WriteHeader(c.status)
+		}))
+		host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+		p, _ := strconv.Atoi(port)
+		client, err := NewPeerClient(Peer{Address: host, Port: p, Scheme: "http"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = client.Pair(context.Background(), "123456")
+		srv.Close()
+		if (err == nil) != c.ok {
+			t.Errorf("%s: Pair returned %v", c.name, err)
+		}
+		if errors.Is(err, ErrWrongPIN) != c.wrongPIN {
+			t.Errorf("%s: Pair returned %v; wrong PIN expected %v", c.name, err, c.wrongPIN)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+// Command beamsync runs a BeamSync receiver or sender without the desktop
+// app, for servers, SSH sessions and scripts.
+//
+//	beamsync receive [--dir DIR] [--port N] [flags]
+//	beamsync send [flags] <files...>
+//
+// Exit status: 0 when the transfer completed, 1 when it failed or the
+// server could not start, 2 for usage errors, 3 when --timeout passed before
+// any transfer started and 130 when interrupted first. With --keep the
+// command serves until interrupted and exits 1 if any transfer failed.
+package main
+
+import (
+	"beamsync"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitTimeout     = 3
+	exitInterrupted = 130
+)
+
+// settleDelay is how long a receiver waits after the last file before
+// treating the transfer as complete; phones upload one file after another.
+const settleDelay = 3 * time.Second
+
+// shutdownGrace is how long transfers still running on exit get to finish.
+const shutdownGrace = 10 * time.Second
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitUsage
+	}
+	switch args[0] {
+	case "receive":
+		return receive(args[1:])
+	case "send":
+		return send(args[1:])
+	case "help", "-h", "--help":
+		usage()
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "beamsync: unknown command %q\n", args[0])
+		usage()
+		return exitUsage
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  beamsync receive [--dir DIR] [--port N] [flags]   wait for files from a phone
+  beamsync send [flags] <files...>                  share files with a phone
+
+Run "beamsync <command> -h" for the flags of each command.`)
+}
+
+// sessionFlags are shared by both commands.
+type sessionFlags struct {
+	noPair  bool
+	secure  bool
+	keep    bool
+	invert  bool
+	timeout time.Duration
+}
+
+func (s *sessionFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&s.noPair, "no-pair", false, "let anyone on the network connect without the PIN")
+	fs.BoolVar(&s.secure, "secure", false, "serve HTTPS with this machine's BeamSync certificate")
+	fs.BoolVar(&s.keep, "keep", false, "keep serving after each transfer until interrupted")
+	fs.BoolVar(&s.invert, "invert", false, "draw the QR code for a light terminal background")
+	fs.DurationVar(&s.timeout, "timeout", 0, "give up if no transfer starts within this time (0 waits forever)")
+}
+
+func (s *sessionFlags) pairing() (*beamsync.Pairing, error) {
+	if s.noPair {
+		return nil, nil
+	}
+	return beamsync.NewPairing()
+}
+
+// identity loads the certificate the desktop app uses, so phones that
+// trusted it there trust it here too.
+func (s *sessionFlags) identity() (*beamsync.TLSIdentity, error) {
+	if !s.secure {
+		return nil, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return beamsync.LoadOrCreateIdentity(filepath.Join(configDir, "beamsync", "tls"))
+}
+
+func receive(args []string) (status int) {
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "folder to save received files in")
+	port := fs.Int("port", 3000, "first port to try")
+	conflict := fs.String("on-conflict", string(beamsync.CollisionRename), "when a name is taken: rename, overwrite, skip or newer")
+	var session sessionFlags
+	session.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "beamsync: receive takes no arguments")
+		return exitUsage
+	}
+	policy := beamsync.CollisionPolicy(*conflict)
+	if !policy.Valid() {
+		fmt.Fprintf(os.Stderr, "beamsync: unknown --on-conflict %q\n", *conflict)
+		return exitUsage
+	}
+
+	pairing, identity, code := session.setup()
+	if code != exitOK {
+		return code
+	}
+
+	server := beamsync.NewReceiver(beamsync.ReceiverOptions{
+		UploadDir: *dir,
+		Port:      *port,
+		Collision: policy,
+		Pairing:   pairing,
+		Identity:  identity,
+	})
+	if err := server.Start(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Receiver failed to start:", err)
+		return exitFailed
+	}
+	defer stop(server, &status)
+	// Stop listening first; nothing reads events once the command is done
+	events, unwatch := watchEvents(server)
+	defer unwatch()
+
+	absDir, _ := filepath.Abs(*dir)
+	fmt.Println("📁 Saving to", absDir)
+	session.announce(pairing, identity, server.Port())
+
+	return session.wait(events, &receiveTransfer{})
+}
+
+func send(args []string) (status int) {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	var session sessionFlags
+	session.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "beamsync: send needs at least one file")
+		return exitUsage
+	}
+
+	paths := fs.Args()
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			fmt.Fprintln(os.Stderr, "beamsync:", err)
+			return exitUsage
+		}
+	}
+
+	pairing, identity, code := session.setup()
+	if code != exitOK {
+		return code
+	}
+
+	server := beamsync.NewSender(beamsync.SenderOptions{
+		Paths:    paths,
+		Pairing:  pairing,
+		Identity: identity,
+	})
+	if err := server.Start(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Sender failed to start:", err)
+		return exitFailed
+	}
+	defer stop(server, &status)
+	// Stop listening first; nothing reads events once the command is done
+	events, unwatch := watchEvents(server)
+	defer unwatch()
+
+	session.announce(pairing, identity, server.Port())
+
+	return session.wait(events, newSendTransfer(paths))
+}
+
+// stop lets in-flight transfers finish before shutting the server down.
+// Another interrupt cuts them off at once; a cut-off transfer turns a
+// successful exit into a failure.
+func stop(server *beamsync.HTTPServer, status *int) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	aborted, err := server.Shutdown(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "⚠️ Shutdown:", err)
+	}
+	if len(aborted) > 0 {
+		fmt.Fprintf(os.Stderr, "✂️ %d transfer(s) cut off\n", len(aborted))
+		if *status == exitOK {
+			*status = exitFailed
+		}
+	}
+}
+
+// setup prepares pairing and TLS, turning failures into an exit status.
+func (s *sessionFlags) setup() (*beamsync.Pairing, *beamsync.TLSIdentity, int) {
+	pairing, err := s.pairing()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to set up pairing:", err)
+		return nil, nil, exitFailed
+	}
+	identity, err := s.identity()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to load certificate:", err)
+		return nil, nil, exitFailed
+	}
+	return pairing, identity, exitOK
+}
+
+// announce prints the address to open along with its QR code.
+func (s *sessionFlags) announce(pairing *beamsync.Pairing, identity *beamsync.TLSIdentity, port int) {
+	url := pairing.URL(identity.Scheme() + "://" + net.JoinHostPort(localIP(), strconv.Itoa(port)))
+	if fp := identity.Fingerprint(); fp != "" {
+		url += "#fp=" + fp
+	}
+
+	fmt.Println("========================================")
+	if qr, err := encodeQR(url); err == nil {
+		fmt.Print(qr.terminal(s.invert))
+	}
+	fmt.Println("📱 Open this URL on your phone:")
+	fmt.Println("  ", url)
+	if pairing != nil {
+		fmt.Println("🔑 Pairing PIN:", pairing.PIN())
+	}
+	if fp := identity.DisplayFingerprint(); fp != "" {
+		fmt.Println("🔏 Certificate SHA-256:", fp)
+	}
+	fmt.Println("========================================")
+}
+
+// transfer follows the events of one command to decide when it is done.
+type transfer interface {
+	observe(e beamsync.Event)
+	// ready fires once the transfer looks finished
+	ready() <-chan time.Time
+	// finish reports the exit status and resets for the next transfer
+	finish() int
+}
+
+// wait logs events until the transfer finishes, the timeout passes or the
+// user interrupts. The timeout only covers the wait for a first transfer;
+// once one starts, only its completion or failure ends the run. With
+// --keep it carries on until interrupted.
+func (s *sessionFlags) wait(events <-chan beamsync.Event, t transfer) int {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	var timeout <-chan time.Time
+	if s.timeout > 0 {
+		timeout = time.After(s.timeout)
+	}
+
+	status := exitInterrupted
+	for {
+		select {
+		case e := <-events:
+			logEvent(e)
+			t.observe(e)
+			switch e.(type) {
+			case beamsync.TransferStarted, beamsync.TransferProgress:
+				timeout = nil
+			}
+		case <-t.ready():
+			code := t.finish()
+			if !s.keep {
+				return code
+			}
+			// Once one transfer failed, the session as a whole failed
+			if status != exitFailed {
+				status = code
+			}
+			timeout = nil
+		case <-timeout:
+			fmt.Fprintln(os.Stderr, "⏱️ Timed out waiting for a transfer")
+			return exitTimeout
+		case <-interrupt:
+			fmt.Println("\n🛑 Interrupted")
+			return status
+		}
+	}
+}
+
+// receiveTransfer is done once files stop arriving for settleDelay.
+type receiveTransfer struct {
+	received, failed int
+	settle           <-chan time.Time
+}
+
+func (r *receiveTransfer) observe(e beamsync.Event) {
+	switch e.(type) {
+	case beamsync.FileReceived, beamsync.FileSkipped:
+		r.received++
+	case beamsync.TransferFailed, beamsync.IntegrityFailed:
+		r.failed++
+	case beamsync.TransferProgress:
+		if r.settle == nil {
+			return
+		}
+	default:
+		return
+	}
+	r.settle = time.After(settleDelay)
+}
+
+func (r *receiveTransfer) ready() <-chan time.Time { return r.settle }
+
+func (r *receiveTransfer) finish() int {
+	fmt.Printf("📊 %d file(s) received, %d failed\n", r.received, r.failed)
+	status := exitOK
+	if r.failed > 0 {
+		status = exitFailed
+	}
+	*r = receiveTransfer{}
+	return status
+}
+
+// sendTransfer is done once every shared item, or the zip of all of
+// them, has been downloaded.
+type sendTransfer struct {
+	paths   []string
+	pending map[string]bool
+	done    <-chan time.Time
+}
+
+func newSendTransfer(paths []string) *sendTransfer {
+	t := &sendTransfer{paths: paths}
+	t.reset()
+	return t
+}
+
+func (t *sendTransfer) reset() {
+	t.pending = make(map[string]bool)
+	for _, p := range t.paths {
+		t.pending[filepath.Base(p)] = true
+	}
+	t.done = nil
+}
+
+func (t *sendTransfer) observe(e beamsync.Event) {
+	sent, ok := e.(beamsync.FileSent)
+	if !ok || t.done != nil {
+		return
+	}
+	if sent.Name == "BeamSync.zip" {
+		clear(t.pending)
+	}
+	delete(t.pending, sent.Name)
+	if len(t.pending) == 0 {
+		// Give the last response time to reach the phone before closing
+		t.done = time.After(time.Second)
+	}
+}
+
+func (t *sendTransfer) ready() <-chan time.Time { return t.done }
+
+func (t *sendTransfer) finish() int {
+	fmt.Println("📊 Everything was downloaded")
+	t.reset()
+	return exitOK
+}
+
+// watchEvents routes the server's events into a channel for the main loop.
+// Call unwatch once the loop stops reading so emitters aren't held up.
+func watchEvents(server *beamsync.HTTPServer) (events <-chan beamsync.Event, unwatch func()) {
+	ch := make(chan beamsync.Event, 100)
+	stopped := make(chan struct{})
+	sub := server.Subscribe(func(_ string, e beamsync.Event) {
+		select {
+		case ch <- e:
+		case <-stopped:
+		}
+	}, beamsync.SubscribeOptions{})
+	return ch, func() {
+		close(stopped)
+		sub.Close()
+	}
+}
+
+// lastPercent throttles progress lines to one per 10% per file.
+var lastPercent = make(map[string]int)
+
+func logEvent(e beamsync.Event) {
+	stamp := time.Now().Format("15:04:05")
+
+	switch e := e.(type) {
+	case beamsync.TransferProgress:
+		if e.Total <= 0 {
+			return
+		}
+		percent := int(e.Written * 100 / e.Total)
+		if percent/10 == lastPercent[e.Name]/10 && percent != 100 {
+			return
+		}
+		lastPercent[e.Name] = percent
+		fmt.Printf("[%s] ⏳ %s %d%% (%.1f MB/s)\n", stamp, e.Name, percent, e.BytesPerSec/1024/1024)
+	case beamsync.FileReceived:
+		delete(lastPercent, e.Name)
+		fmt.Printf("[%s] ✅ Received %s\n", stamp, e.Name)
+	case beamsync.FileSent:
+		fmt.Printf("[%s] ✅ Downloaded %s\n", stamp, e.Name)
+	case beamsync.FileSkipped:
+		fmt.Printf("[%s] ⏭️ Skipped %s (name taken)\n", stamp, e.Name)
+	case beamsync.TransferFailed:
+		fmt.Printf("[%s] ❌ Failed %s: %s\n", stamp, e.Name, e.Reason)
+	case beamsync.IntegrityFailed:
+		fmt.Printf("[%s] ❌ Checksum mismatch for %s\n", stamp, e.Name)
+	case beamsync.DeviceConnected:
+		fmt.Printf("[%s] 📱 Connected: %s\n", stamp, e.Name)
+	case beamsync.DeviceDisconnected:
+		fmt.Printf("[%s] 📴 Disconnected: %s\n", stamp, e.Name)
+	case beamsync.PairingRequired:
+		fmt.Printf("[%s] 🔑 %s is asking to pair\n", stamp, e.IP)
+	case beamsync.Paired:
+		fmt.Printf("[%s] 🔗 Paired with %s\n", stamp, e.IP)
+	case beamsync.TransferStarted:
+		// Progress lines follow soon enough
+	default:
+		payload, _ := beamsync.MarshalEvent("", e)
+		fmt.Printf("[%s] 📡 %s\n", stamp, payload)
+	}
+}
+
+func localIP() string {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"beamsync"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestUsageErrors checks bad command lines exit with 2 before any server
+// starts.
+func TestUsageErrors(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+	for _, args := range [][]string{
+		{},
+		{"upload"},
+		{"receive", "--bogus"},
+		{"receive", "extra"},
+		{"receive", "--port", "many"},
+		{"receive", "--on-conflict", "append"},
+		{"receive", "--timeout", "soon"},
+		{"send"},
+		{"send", "--invert"},
+		{"send", missing},
+	} {
+		if got := run(args); got != exitUsage {
+			t.Errorf("run(%q) = %d, want %d", args, got, exitUsage)
+		}
+	}
+	if got := run([]string{"help"}); got != exitOK {
+		t.Errorf("run(help) = %d, want %d", got, exitOK)
+	}
+}
+
+func TestSessionFlags(t *testing.T) {
+	var s sessionFlags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	s.register(fs)
+	if err := fs.Parse([]string{"--no-pair", "-secure", "--keep", "--invert", "--timeout", "90s", "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	want := sessionFlags{noPair: true, secure: true, keep: true, invert: true, timeout: 90 * time.Second}
+	if s != want {
+		t.Errorf("parsed %+v, want %+v", s, want)
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "a.txt" {
+		t.Errorf("arguments %q, want [a.txt]", fs.Args())
+	}
+	if p, err := s.pairing(); p != nil || err != nil {
+		t.Errorf("pairing with --no-pair = %v, %v", p, err)
+	}
+}
+
+func TestSendTransferCompletes(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		paths []string
+		sent  []string
+	}{
+		{"one file", []string{"/tmp/a.txt"}, []string{"a.txt"}},
+		{"each item", []string{"/tmp/a.txt", "/tmp/photos"}, []string{"photos", "a.txt"}},
+		{"zip of all", []string{"/tmp/a.txt", "/tmp/photos"}, []string{"BeamSync.zip"}},
+		{"one folder as a zip", []string{"/tmp/photos/"}, []string{"BeamSync.zip"}},
+		{"one folder", []string{"/tmp/photos/"}, []string{"photos"}},
+	} {
+		tr := newSendTransfer(c.paths)
+		for i, name := range c.sent {
+			if tr.ready() != nil {
+				t.Errorf("%s: done before %s was sent", c.name, name)
+			}
+			tr.observe(beamsync.FileSent{Name: name})
+			if i < len(c.sent)-1 {
+				continue
+			}
+			if tr.ready() == nil {
+				t.Errorf("%s: not done after sending %q", c.name, c.sent)
+			}
+		}
+	}
+}
+
+func TestWaitTimesOut(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	s := sessionFlags{timeout: 10 * time.Millisecond}
+	if got := s.wait(make(chan beamsync.Event), &receiveTransfer{}); got != exitTimeout {
+		t.Errorf("wait = %d, want %d", got, exitTimeout)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// matrix renders the modules with # for dark and . for light.
+func (q *qrCode) matrix() string {
+	var b strings.Builder
+	for _, row := range q.modules {
+		for _, dark := range row {
+			if dark {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// TestEncodeQRGolden compares whole symbols against ones produced by an
+// independent encoder (byte mode, level L, same mask), so any slip in the
+// codewords, placement, masking or format bits shows up.
+func TestEncodeQRGolden(t *testing.T) {
+	for _, c := range []struct {
+		text, golden string
+	}{
+		{"http://192.168.1.23:3000", "testdata/qr-v2.txt"},
+		{"https://example.test/" + strings.Repeat("a", 130), "testdata/qr-v7.txt"}, // with version information
+	} {
+		want, err := os.ReadFile(c.golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := encodeQR(c.text)
+		if err != nil {
+			t.Fatalf("encodeQR(%q): %v", c.text, err)
+		}
+		if got := q.matrix(); got != string(want) {
+			t.Errorf("encodeQR(%q) differs from %s:\n%s", c.text, c.golden, got)
+		}
+	}
+}
+
+func TestEncodeQRVersions(t *testing.T) {
+	for _, c := range []struct {
+		length, version int
+	}{
+		{1, 1},
+		{17, 1},
+		{18, 2},
+		{32, 2},
+		{33, 3},
+		{230, 9},
+		{231, 10},
+		{271, 10},
+	} {
+		q, err := encodeQR(strings.Repeat("a", c.length))
+		if err != nil {
+			t.Errorf("%d bytes: %v", c.length, err)
+			continue
+		}
+		if want := 17 + 4*c.version; q.size != want {
+			t.Errorf("%d bytes: size %d, want %d (version %d)", c.length, q.size, want, c.version)
+		}
+	}
+	if _, err := encodeQR(strings.Repeat("a", 272)); !errors.Is(err, errQRTooLong) {
+		t.Errorf("272 bytes: %v, want errQRTooLong", err)
+	}
+}
+
+// TestTerminalQuietZone checks the 4-module light border ISO/IEC 18004
+// asks for, in both colour schemes.
+func TestTerminalQuietZone(t *testing.T) {
+	q, err := encodeQR("http://192.168.1.23:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := q.size + 8
+	for _, invert := range []bool{false, true} {
+		// Light modules are drawn unless inverted
+		light := "█"
+		if invert {
+			light = " "
+		}
+		lines := strings.Split(strings.TrimSuffix(q.terminal(invert), "\n"), "\n")
+		if len(lines) != (width+1)/2 {
+			t.Fatalf("invert=%v: %d lines, want %d", invert, len(lines), (width+1)/2)
+		}
+		for i, line := range lines {
+			if n := utf8.RuneCountInString(line); n != width {
+				t.Fatalf("invert=%v: line %d is %d wide, want %d", invert, i, n, width)
+			}
+			runes := []rune(line)
+			border := string(runes[:4]) + string(runes[width-4:])
+			if i < 2 || i >= len(lines)-2 {
+				border = line
+			}
+			if border != strings.Repeat(light, len([]rune(border))) {
+				t.Errorf("invert=%v: line %d %q has dark modules in the quiet zone", invert, i, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package beamsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CollisionPolicy decides what happens when a received file's name is
+// already taken in the upload directory.
+type CollisionPolicy string
+
+const (
+	// CollisionRename keeps both files: "photo.jpg" becomes "photo (1).jpg".
+	CollisionRename CollisionPolicy = "rename"
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionSkip keeps the existing file and drops the incoming one.
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionKeepNewer keeps whichever file was modified last. Incoming
+	// files without a known modification time lose to the existing one.
+	CollisionKeepNewer CollisionPolicy = "newer"
+)
+
+// errFileSkipped reports that the collision policy rejected a file.
+var errFileSkipped = errors.New("file skipped by collision policy")
+
+// placeMutex serialises name resolution with file placement so two
+// concurrent uploads of the same name can't both claim it.
+var placeMutex sync.Mutex
+
+// Valid reports whether p is one of the known policies.
+func (p CollisionPolicy) Valid() bool {
+	switch p {
+	case CollisionRename, CollisionOverwrite, CollisionSkip, CollisionKeepNewer:
+		return true
+	}
+	return false
+}
+
+// placeFile resolves name inside dir according to policy and calls place
+// with the chosen path while still holding the lock. It returns the final
+// file name, or errFileSkipped when the incoming file must be discarded.
+func placeFile(dir, name string, policy CollisionPolicy, modTime time.Time, place func(dstPath string) error) (string, error) {
+	placeMutex.Lock()
+	defer placeMutex.Unlock()
+
+	finalName, err := resolveCollision(dir, name, policy, modTime)
+	if err != nil {
+		return "", err
+	}
+
+	dstPath := filepath.Join(dir, finalName)
+	if err := place(dstPath); err != nil {
+		return "", err
+	}
+
+	if !modTime.IsZero() {
+		if err := os.Chtimes(dstPath, modTime, modTime); err != nil {
+			fmt.Println("⚠️ Failed to restore modification time:", err)
+		}
+	}
+	return finalName, nil
+}
+
+func resolveCollision(dir, name string, policy CollisionPolicy, modTime time.Time) (string, error) {
+	existing, err := os.Stat(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch policy {
+	case CollisionOverwrite:
+		return name, nil
+	case CollisionSkip:
+		return "", errFileSkipped
+	case CollisionKeepNewer:
+		if modTime.IsZero() || !modTime.After(existing.ModTime()) {
+			return "", errFileSkipped
+		}
+		return name, nil
+	default:
+		return nextFreeName(dir, name)
+	}
+}
+
+// parseLastModified reads a client's lastModified value, Unix milliseconds
+// as browsers report them; anything else is the zero time.
+func parseLastModified(value string) time.Time {
+	ms, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// nextFreeName returns "name (n).ext" for the first n not yet taken.
+func nextFreeName(dir, name string) (string, error) {
+	stem, ext := splitExt(name)
+
+	for i := 1; i < 10000; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, err := os.Stat(filepath.Join(dir, candidate)); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %s", name)
+}
+
+// doubleExts are extensions spanning two dots, kept whole when numbering.
+var doubleExts = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst"}
+
+// splitExt splits name into stem and extension for numbering. A leading
+// dot belongs to the stem, so ".bashrc" has no extension.
+func splitExt(name string) (stem, ext string) {
+	lower := strings.ToLower(name)
+	for _, double := range doubleExts {
+		if len(name) > len(double) && strings.HasSuffix(lower, double) {
+			cut := len(name) - len(double)
+			return name[:cut], name[cut:]
+		}
+	}
+	ext = filepath.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
@@ -0,0 +1,161 @@
+package beamsync
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNextFreeName(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{"photo.jpg", nil, "photo (1).jpg"},
+		{"photo.jpg", []string{"photo (1).jpg", "photo (2).jpg"}, "photo (3).jpg"},
+		{"README", nil, "README (1)"},
+		{".bashrc", nil, ".bashrc (1)"},
+		{".config.json", nil, ".config (1).json"},
+		{"archive.tar.gz", nil, "archive (1).tar.gz"},
+		{"Backup.TAR.XZ", nil, "Backup (1).TAR.XZ"},
+		{".tar.gz", nil, ".tar (1).gz"},
+		{"v1.2.zip", nil, "v1.2 (1).zip"},
+	} {
+		dir := t.TempDir()
+		for _, name := range append([]string{c.name}, c.taken...) {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := nextFreeName(dir, c.name)
+		if err != nil || got != c.want {
+			t.Errorf("nextFreeName(%q) with %v taken = %q, %v; want %q", c.name, c.taken, got, err, c.want)
+		}
+	}
+}
+
+func TestPlaceFile(t *testing.T) {
+	existingTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, c := range []struct {
+		name     string
+		policy   CollisionPolicy
+		exists   bool
+		modTime  time.Time
+		wantName string
+		wantData string // "" when skipped
+	}{
+		{"free name", CollisionRename, false, time.Time{}, "a.txt", "new"},
+		{"rename", CollisionRename, true, time.Time{}, "a (1).txt", "new"},
+		{"overwrite", CollisionOverwrite, true, time.Time{}, "a.txt", "new"},
+		{"skip", CollisionSkip, true, time.Time{}, "", ""},
+		{"skip free name", CollisionSkip, false, time.Time{}, "a.txt", "new"},
+		{"newer wins", CollisionKeepNewer, true, existingTime.Add(time.Minute), "a.txt", "new"},
+		{"older loses", CollisionKeepNewer, true, existingTime.Add(-time.Minute), "", ""},
+		{"same time loses", CollisionKeepNewer, true, existingTime, "", ""},
+		{"unknown time loses", CollisionKeepNewer, true, time.Time{}, "", ""},
+	} {
+		dir := t.TempDir()
+		existing := filepath.Join(dir, "a.txt")
+		if c.exists {
+			if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(existing, existingTime, existingTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := placeFile(dir, "a.txt", c.policy, c.modTime, func(dstPath string) error {
+			return os.WriteFile(dstPath, []byte("new"), 0644)
+		})
+		if c.wantData == "" {
+			if !errors.Is(err, errFileSkipped) {
+				t.Errorf("%s: got %q, %v; want errFileSkipped", c.name, got, err)
+			}
+			if data, _ := os.ReadFile(existing); string(data) != "old" {
+				t.Errorf("%s: existing file now holds %q", c.name, data)
+			}
+			continue
+		}
+		if err != nil || got != c.wantName {
+			t.Errorf("%s: got %q, %v; want %q", c.name, got, err, c.wantName)
+			continue
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, got)); string(data) != c.wantData {
+			t.Errorf("%s: %s holds %q, want %q", c.name, got, data, c.wantData)
+		}
+		if c.exists && got != "a.txt" {
+			if data, _ := os.ReadFile(existing); string(data) != "old" {
+				t.Errorf("%s: existing file now holds %q", c.name, data)
+			}
+		}
+		if !c.modTime.IsZero() {
+			if info, err := os.Stat(filepath.Join(dir, got)); err != nil || !info.ModTime().Equal(c.modTime) {
+				t.Errorf("%s: modification time not restored to %v", c.name, c.modTime)
+			}
+		}
+	}
+}
+
+func TestParseLastModified(t *testing.T) {
+	for value, want := range map[string]time.Time{
+		"1700000000000":   time.UnixMilli(1700000000000),
+		" 1700000000000 ": time.UnixMilli(1700000000000),
+		"":                {},
+		"0":               {},
+		"-5":              {},
+		"yesterday":       {},
+	} {
+		if got := parseLastModified(value); !got.Equal(want) {
+			t.Errorf("parseLastModified(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+// TestKeepNewerMultipart sends the same name twice through /upload with a
+// lastModified field; only the newer copy may replace the file.
+func TestKeepNewerMultipart(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(uploadHandler(dir, CollisionKeepNewer, nil, nil))
+	defer srv.Close()
+
+	existing := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	if err := os.Chtimes(existing, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(data string, modTime time.Time) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("lastModified", strconv.FormatInt(modTime.UnixMilli(), 10))
+		part, _ := mw.CreateFormFile("documents", "a.txt")
+		part.Write([]byte(data))
+		mw.Close()
+		resp, err := http.Post(srv.URL, mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	send("older", stamp.Add(-time.Minute))
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("older upload replaced the file with %q", data)
+	}
+	send("newer", stamp.Add(time.Minute))
+	if data, _ := os.ReadFile(existing); string(data) != "newer" {
+		t.Errorf("newer upload left %q", data)
+	}
+}
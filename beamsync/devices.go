@@ -0,0 +1,307 @@
+package beamsync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device is a phone or browser talking to one of the servers.
+type Device struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"userAgent"`
+	Role        string    `json:"role"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+const (
+	clientCookie  = "beamsync_client"
+	clientHeader  = "BeamSync-Client"
+	deviceTimeout = 15 * time.Second
+	// streamGrace lets a page reload reopen its event stream without the
+	// device flickering out and back in.
+	streamGrace = 3 * time.Second
+)
+
+type clientIDKey struct{}
+
+// deviceTracker keeps one session per client ID for a single server, so
+// two phones show up as two devices and the sender's traffic never keeps
+// the receiver "connected".
+type deviceTracker struct {
+	role   string
+	events *emitter
+	key    []byte // signs the client secrets this server hands out
+
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	devices map[string]*trackedDevice
+}
+
+type trackedDevice struct {
+	Device
+	active  int // requests in flight; a long upload keeps the device alive
+	streams map[chan streamMessage]bool
+}
+
+func newDeviceTracker(role string, events *emitter) *deviceTracker {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &deviceTracker{role: role, events: events, key: key, closing: make(chan struct{}), devices: make(map[string]*trackedDevice)}
+}
+
+// closeStreams ends every open event stream, telling the pages why.
+func (t *deviceTracker) closeStreams() {
+	t.closeOnce.Do(func() { close(t.closing) })
+}
+
+// Track wraps a server mux so every request refreshes its device's session.
+// The first request from a new client emits device_connected.
+func (t *deviceTracker) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := t.clientID(w, r)
+		t.touch(id, r, 1)
+		defer t.touch(id, r, -1)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIDKey{}, id)))
+	})
+}
+
+func (t *deviceTracker) touch(id string, r *http.Request, delta int) {
+	now := time.Now()
+	t.mu.Lock()
+	d, ok := t.devices[id]
+	if !ok {
+		d = &trackedDevice{
+			Device: Device{
+				ID:          id,
+				Name:        deviceName(r),
+				Role:        t.role,
+				ConnectedAt: now,
+			},
+			streams: make(map[chan streamMessage]bool),
+		}
+		t.devices[id] = d
+	}
+	d.IP = clientIP(r)
+	d.UserAgent = r.UserAgent()
+	d.LastSeen = now
+	d.active += delta
+	device := d.Device
+	t.mu.Unlock()
+
+	if !ok {
+		fmt.Printf("💚 Device connected to %s: %s\n", t.role, device.Name)
+		t.events.emit(DeviceConnected{device})
+	}
+}
+
+// Watch drops devices that have gone quiet until ctx is cancelled,
+// emitting device_disconnected for each. Pages holding an event stream
+// never go quiet; this catches clients on the heartbeat fallback.
+func (t *deviceTracker) Watch(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("⚠️ Watchdog panic: %v\n", r)
+		}
+	}()
+
+	fmt.Printf("👁️ Watchdog started (%s)\n", t.role)
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("🛑 Watchdog stopped (%s)\n", t.role)
+			return
+		case <-ticker.C:
+			for _, device := range t.expire(deviceTimeout) {
+				t.disconnected(device, "timeout")
+			}
+		}
+	}
+}
+
+func (t *deviceTracker) expire(timeout time.Duration) []Device {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var gone []Device
+	for id, d := range t.devices {
+		if d.active <= 0 && time.Since(d.LastSeen) > timeout {
+			gone = append(gone, d.Device)
+			delete(t.devices, id)
+		}
+	}
+	return gone
+}
+
+func (t *deviceTracker) disconnected(device Device, reason string) {
+	fmt.Printf("💔 Device disconnected from %s (%s): %s\n", t.role, reason, device.Name)
+	t.events.emit(DeviceDisconnected{device})
+}
+
+// subscribe attaches an event stream to a device.
+func (t *deviceTracker) subscribe(id string) chan streamMessage {
+	ch := make(chan streamMessage, 16)
+	t.mu.Lock()
+	if d, ok := t.devices[id]; ok {
+		d.streams[ch] = true
+	}
+	t.mu.Unlock()
+	return ch
+}
+
+// unsubscribe detaches a stream. Once a device's last stream has been gone
+// for streamGrace with nothing else in flight, it is disconnected at once
+// rather than after the heartbeat timeout.
+func (t *deviceTracker) unsubscribe(id string, ch chan streamMessage) {
+	closed := time.Now()
+	t.mu.Lock()
+	if d, ok := t.devices[id]; ok {
+		delete(d.streams, ch)
+	}
+	t.mu.Unlock()
+
+	time.AfterFunc(streamGrace, func() {
+		t.mu.Lock()
+		d, ok := t.devices[id]
+		// The stream's own request winds down just after it closes; anything
+		// heard later means the device is still around
+		quiet := ok && !d.LastSeen.After(closed.Add(time.Second))
+		idle := quiet && len(d.streams) == 0 && d.active <= 0
+		if idle {
+			delete(t.devices, id)
+		}
+		t.mu.Unlock()
+
+		if idle {
+			t.disconnected(d.Device, "stream closed")
+		}
+	})
+}
+
+// Push sends a message to every open stream of one device. It reports
+// false if the device has no stream, e.g. a page on the heartbeat fallback.
+func (t *deviceTracker) Push(id string, msg streamMessage) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.devices[id]
+	if !ok || len(d.streams) == 0 {
+		return false
+	}
+	for ch := range d.streams {
+		select {
+		case ch <- msg:
+		default:
+			fmt.Printf("⚠️ Stream to %s is full, dropping %s\n", d.Name, msg.Event)
+		}
+	}
+	return true
+}
+
+// Broadcast pushes a message to every connected device and returns how
+// many received it.
+func (t *deviceTracker) Broadcast(msg streamMessage) int {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.devices))
+	for id := range t.devices {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	n := 0
+	for _, id := range ids {
+		if t.Push(id, msg) {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the connected devices, oldest connection first.
+func (t *deviceTracker) List() []Device {
+	t.mu.Lock()
+	devices := make([]Device, 0, len(t.devices))
+	for _, d := range t.devices {
+		devices = append(devices, d.Device)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ConnectedAt.Before(devices[j].ConnectedAt)
+	})
+	return devices
+}
+
+// clientID identifies the device behind a request by a secret only the
+// client holds: the BeamSync-Client header of scripted clients, otherwise
+// a cookie issued on first contact. The ID is a hash of that secret, so
+// knowing a device's ID doesn't let another client pass as it. Clients
+// that keep no cookie get the same secret again, derived from their
+// address and user agent.
+func (t *deviceTracker) clientID(w http.ResponseWriter, r *http.Request) string {
+	secret := r.Header.Get(clientHeader)
+	if !validClientID(secret) {
+		if cookie, err := r.Cookie(clientCookie); err == nil && validClientID(cookie.Value) {
+			secret = cookie.Value
+		} else {
+			mac := hmac.New(sha256.New, t.key)
+			mac.Write([]byte(clientIP(r) + "|" + r.UserAgent()))
+			secret = hex.EncodeToString(mac.Sum(nil)[:16])
+			http.SetCookie(w, &http.Cookie{
+				Name:     clientCookie,
+				Value:    secret,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+func validClientID(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// deviceName describes the client for the desktop UI.
+func deviceName(r *http.Request) string {
+	ua := r.UserAgent()
+	kind := "Device"
+	for _, k := range []string{"iPhone", "iPad", "Android", "Windows", "Macintosh", "Linux"} {
+		if strings.Contains(ua, k) {
+			kind = k
+			break
+		}
+	}
+	if kind == "Macintosh" {
+		kind = "Mac"
+	}
+	return fmt.Sprintf("%s (%s)", kind, clientIP(r))
+}
@@ -0,0 +1,46 @@
+package beamsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIDBoundToSecret(t *testing.T) {
+	tracker := newDeviceTracker("receiver", nil)
+
+	// A phone's first visit is issued a cookie; sending it back keeps the ID
+	w := httptest.NewRecorder()
+	first := httptest.NewRequest(http.MethodGet, "/", nil)
+	phoneID := tracker.clientID(w, first)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != clientCookie {
+		t.Fatalf("no client cookie issued: %v", cookies)
+	}
+	if cookies[0].Value == phoneID {
+		t.Fatal("cookie holds the device ID itself")
+	}
+	again := httptest.NewRequest(http.MethodGet, "/", nil)
+	again.AddCookie(cookies[0])
+	if id := tracker.clientID(httptest.NewRecorder(), again); id != phoneID {
+		t.Errorf("same cookie gave ID %s, want %s", id, phoneID)
+	}
+
+	// Presenting the ID itself, as a cookie or header, is a different device
+	for _, claim := range []func(*http.Request){
+		func(r *http.Request) { r.AddCookie(&http.Cookie{Name: clientCookie, Value: phoneID}) },
+		func(r *http.Request) { r.Header.Set(clientHeader, phoneID) },
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.66:1234"
+		claim(r)
+		if id := tracker.clientID(httptest.NewRecorder(), r); id == phoneID {
+			t.Error("another client claimed the phone's ID")
+		}
+	}
+
+	// A client that drops cookies keeps one ID
+	if id := tracker.clientID(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)); id != phoneID {
+		t.Errorf("cookieless repeat gave ID %s, want %s", id, phoneID)
+	}
+}
@@ -0,0 +1,201 @@
+package beamsync
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Peer is another BeamSync instance found on the LAN.
+type Peer struct {
+	ID          string `json:"id"` // DNS-SD instance name
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	Address     string `json:"address"`
+	Port        int    `json:"port"`
+	Scheme      string `json:"scheme"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// URL is the peer's base address.
+func (p Peer) URL() string {
+	return p.Scheme + "://" + net.JoinHostPort(p.Address, strconv.Itoa(p.Port))
+}
+
+// DiscoverPeers browses _beamsync._tcp for the given duration and returns
+// every complete service found, receivers first.
+func DiscoverPeers(ctx context.Context, wait time.Duration) ([]Peer, error) {
+	// A query from an ephemeral port is answered by unicast straight back
+	// to us, so there's no need to share port 5353
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	query, err := (&dnsMessage{
+		Questions: []dnsQuestion{{Name: beamsyncService, Type: dnsTypePTR, Class: dnsClassIN}},
+	}).pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Repeat the query in case the first packet is lost
+	go func() {
+		for delay := time.Duration(0); ; delay += 500 * time.Millisecond {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			conn.WriteToUDP(query, mdnsGroup)
+		}
+	}()
+
+	b := newPeerBuilder()
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		if msg, err := parseDNSMessage(buf[:n]); err == nil && msg.Flags&dnsFlagResponse != 0 {
+			b.add(msg)
+		}
+	}
+	return b.peers(), nil
+}
+
+// peerBuilder joins the PTR, SRV, TXT and A records of browse responses,
+// which may arrive spread over several packets.
+type peerBuilder struct {
+	instances map[string]bool
+	srv       map[string]dnsRecord
+	txt       map[string][]string
+	addrs     map[string][]net.IP // a multi-homed peer has several
+}
+
+func newPeerBuilder() *peerBuilder {
+	return &peerBuilder{
+		instances: make(map[string]bool),
+		srv:       make(map[string]dnsRecord),
+		txt:       make(map[string][]string),
+		addrs:     make(map[string][]net.IP),
+	}
+}
+
+func (b *peerBuilder) add(msg *dnsMessage) {
+	for _, r := range append(msg.Answers, msg.Additional...) {
+		key := strings.ToLower(r.Name)
+		switch r.Type {
+		case dnsTypePTR:
+			if sameDNSName(r.Name, beamsyncService) && r.TTL > 0 {
+				b.instances[strings.ToLower(r.Target)] = true
+			}
+		case dnsTypeSRV:
+			b.srv[key] = r
+		case dnsTypeTXT:
+			b.txt[key] = r.Text
+		case dnsTypeA:
+			if !containsIP(b.addrs[key], r.IP) {
+				b.addrs[key] = append(b.addrs[key], r.IP)
+			}
+		}
+	}
+}
+
+func (b *peerBuilder) peers() []Peer {
+	local := localNets()
+	var peers []Peer
+	for instance := range b.instances {
+		srv, ok := b.srv[instance]
+		if !ok {
+			continue
+		}
+		ip := pickAddress(b.addrs[strings.ToLower(srv.Target)], local)
+		if ip == nil {
+			continue
+		}
+
+		txt := make(map[string]string)
+		for _, entry := range b.txt[instance] {
+			k, v, _ := strings.Cut(entry, "=")
+			txt[strings.ToLower(k)] = v
+		}
+		label := srv.Name
+		if suffix := "." + beamsyncService; len(label) > len(suffix) {
+			label = label[:len(label)-len(suffix)]
+		}
+		peer := Peer{
+			ID:          strings.ReplaceAll(strings.ReplaceAll(label, `\.`, "."), `\\`, `\`),
+			Name:        txt["name"],
+			Role:        txt["role"],
+			Address:     ip.String(),
+			Port:        int(srv.Port),
+			Scheme:      txt["scheme"],
+			Fingerprint: txt["fp"],
+		}
+		if peer.Scheme != "https" {
+			peer.Scheme = "http"
+		}
+		if peer.Name == "" {
+			peer.Name = peer.ID
+		}
+		peers = append(peers, peer)
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Role != peers[j].Role {
+			return peers[i].Role == "receiver"
+		}
+		return peers[i].ID < peers[j].ID
+	})
+	return peers
+}
+
+// pickAddress prefers an address on one of our subnets, which we can reach
+// directly, over bridges and VPNs we can't; otherwise the first announced.
+func pickAddress(ips []net.IP, local []*net.IPNet) net.IP {
+	for _, ip := range ips {
+		for _, n := range local {
+			if n.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	return ips[0]
+}
+
+// localNets lists the IPv4 subnets of this machine's interfaces.
+func localNets() []*net.IPNet {
+	addrs, _ := net.InterfaceAddrs()
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, have := range ips {
+		if have.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package beamsync
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickAddressPrefersLocalSubnet(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	docker := net.IPv4(172, 17, 0, 1).To4()
+	home := net.IPv4(192, 168, 1, 20).To4()
+
+	if got := pickAddress([]net.IP{docker, home}, []*net.IPNet{lan}); !got.Equal(home) {
+		t.Errorf("picked %v, want %v", got, home)
+	}
+	if got := pickAddress([]net.IP{docker, home}, nil); !got.Equal(docker) {
+		t.Errorf("without a local match picked %v, want the first, %v", got, docker)
+	}
+	if got := pickAddress(nil, []*net.IPNet{lan}); got != nil {
+		t.Errorf("picked %v from no addresses", got)
+	}
+}
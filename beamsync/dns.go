@@ -0,0 +1,314 @@
+package beamsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// A minimal DNS message codec, just enough for multicast DNS service
+// discovery: A, AAAA, PTR, SRV and TXT records, with name compression
+// understood when parsing but never produced.
+
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypePTR  uint16 = 12
+	dnsTypeTXT  uint16 = 16
+	dnsTypeAAAA uint16 = 28
+	dnsTypeSRV  uint16 = 33
+	dnsTypeANY  uint16 = 255
+
+	dnsClassIN uint16 = 1
+	// The top bit of the class is "cache flush" on records and "unicast
+	// response wanted" (QU) on questions.
+	dnsClassTopBit uint16 = 0x8000
+
+	dnsFlagResponse      uint16 = 0x8000
+	dnsFlagAuthoritative uint16 = 0x0400
+)
+
+var errDNSMalformed = errors.New("malformed DNS message")
+
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type dnsRecord struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	Target string   // PTR, SRV
+	Port   uint16   // SRV
+	Text   []string // TXT
+	IP     net.IP   // A, AAAA
+}
+
+type dnsMessage struct {
+	ID         uint16
+	Flags      uint16
+	Questions  []dnsQuestion
+	Answers    []dnsRecord
+	Additional []dnsRecord
+}
+
+func (m *dnsMessage) pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.Flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additional)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendDNSName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, section := range [][]dnsRecord{m.Answers, m.Additional} {
+		for _, r := range section {
+			if b, err = appendDNSRecord(b, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+func appendDNSRecord(b []byte, r dnsRecord) ([]byte, error) {
+	b, err := appendDNSName(b, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, r.Type)
+	b = binary.BigEndian.AppendUint16(b, r.Class)
+	b = binary.BigEndian.AppendUint32(b, r.TTL)
+
+	lengthAt := len(b)
+	b = append(b, 0, 0)
+	switch r.Type {
+	case dnsTypeA:
+		ip := r.IP.To4()
+		if ip == nil {
+			return nil, errDNSMalformed
+		}
+		b = append(b, ip...)
+	case dnsTypeAAAA:
+		b = append(b, r.IP.To16()...)
+	case dnsTypePTR:
+		if b, err = appendDNSName(b, r.Target); err != nil {
+			return nil, err
+		}
+	case dnsTypeSRV:
+		b = binary.BigEndian.AppendUint16(b, 0) // priority
+		b = binary.BigEndian.AppendUint16(b, 0) // weight
+		b = binary.BigEndian.AppendUint16(b, r.Port)
+		if b, err = appendDNSName(b, r.Target); err != nil {
+			return nil, err
+		}
+	case dnsTypeTXT:
+		if len(r.Text) == 0 {
+			b = append(b, 0)
+		}
+		for _, s := range r.Text {
+			if len(s) > 255 {
+				return nil, errDNSMalformed
+			}
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+	default:
+		return nil, errDNSMalformed
+	}
+	binary.BigEndian.PutUint16(b[lengthAt:], uint16(len(b)-lengthAt-2))
+	return b, nil
+}
+
+// appendDNSName writes a dotted name as labels. A backslash escapes a dot
+// inside a label, as in DNS-SD instance names.
+func appendDNSName(b []byte, name string) ([]byte, error) {
+	for _, label := range splitDNSName(name) {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errDNSMalformed
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+func splitDNSName(name string) []string {
+	var labels []string
+	var label strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '\\' && i+1 < len(name):
+			i++
+			label.WriteByte(name[i])
+		case c == '.':
+			labels = append(labels, label.String())
+			label.Reset()
+		default:
+			label.WriteByte(c)
+		}
+	}
+	if label.Len() > 0 {
+		labels = append(labels, label.String())
+	}
+	return labels
+}
+
+// escapeDNSLabel makes s safe to use as a single label of a dotted name.
+func escapeDNSLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ".", `\.`)
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
+}
+
+func parseDNSMessage(msg []byte) (*dnsMessage, error) {
+	if len(msg) < 12 {
+		return nil, errDNSMalformed
+	}
+	m := &dnsMessage{
+		ID:    binary.BigEndian.Uint16(msg[0:]),
+		Flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	an := int(binary.BigEndian.Uint16(msg[6:]))
+	ns := int(binary.BigEndian.Uint16(msg[8:]))
+	ar := int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return nil, errDNSMalformed
+		}
+		m.Questions = append(m.Questions, dnsQuestion{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i := 0; i < an+ns+ar; i++ {
+		r, next, err := readDNSRecord(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next
+		if r == nil {
+			continue // a type we don't use
+		}
+		if i < an {
+			m.Answers = append(m.Answers, *r)
+		} else {
+			m.Additional = append(m.Additional, *r)
+		}
+	}
+	return m, nil
+}
+
+func readDNSRecord(msg []byte, off int) (*dnsRecord, int, error) {
+	name, off, err := readDNSName(msg, off)
+	if err != nil || off+10 > len(msg) {
+		return nil, 0, errDNSMalformed
+	}
+	r := &dnsRecord{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(msg[off:]),
+		Class: binary.BigEndian.Uint16(msg[off+2:]),
+		TTL:   binary.BigEndian.Uint32(msg[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(msg[off+8:]))
+	start := off + 10
+	end := start + length
+	if end > len(msg) {
+		return nil, 0, errDNSMalformed
+	}
+	data := msg[start:end]
+
+	switch r.Type {
+	case dnsTypeA, dnsTypeAAAA:
+		if len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return nil, 0, errDNSMalformed
+		}
+		r.IP = net.IP(append([]byte(nil), data...))
+	case dnsTypePTR:
+		if r.Target, _, err = readDNSName(msg, start); err != nil {
+			return nil, 0, err
+		}
+	case dnsTypeSRV:
+		if length < 7 {
+			return nil, 0, errDNSMalformed
+		}
+		r.Port = binary.BigEndian.Uint16(data[4:])
+		if r.Target, _, err = readDNSName(msg, start+6); err != nil {
+			return nil, 0, err
+		}
+	case dnsTypeTXT:
+		for i := 0; i < len(data); {
+			n := int(data[i])
+			if i+1+n > len(data) {
+				return nil, 0, errDNSMalformed
+			}
+			if n > 0 {
+				r.Text = append(r.Text, string(data[i+1:i+1+n]))
+			}
+			i += 1 + n
+		}
+	default:
+		return nil, end, nil
+	}
+	return r, end, nil
+}
+
+// readDNSName decodes a possibly compressed name into dotted form, escaping
+// dots inside labels. It returns the offset just past the name.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errDNSMalformed
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errDNSMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		case n > 63 || off+1+n > len(msg):
+			return "", 0, errDNSMalformed
+		default:
+			labels = append(labels, escapeDNSLabel(string(msg[off+1:off+1+n])))
+			off += 1 + n
+		}
+	}
+}
+
+// sameDNSName compares names the way DNS does, ignoring case.
+func sameDNSName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
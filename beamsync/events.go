@@ -0,0 +1,379 @@
+package beamsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is something that happened on a server or client. Each type has a
+// fixed name and encodes to JSON with MarshalEvent. Subscribers receive it
+// with the ID of the server instance that raised it, or "" for events from
+// outside a server such as a PeerClient's progress.
+type Event interface {
+	EventName() string
+}
+
+// DeviceConnected is sent on the first request from a new client.
+type DeviceConnected struct {
+	Device
+}
+
+// DeviceDisconnected is sent when a client's session expires or its event
+// stream drops for good.
+type DeviceDisconnected struct {
+	Device
+}
+
+// PairingRequired is sent once per address when an unpaired device asks
+// for the PIN.
+type PairingRequired struct {
+	IP string `json:"ip"`
+}
+
+// Paired is sent when a device enters the right PIN.
+type Paired struct {
+	IP string `json:"ip"`
+}
+
+// TransferStarted is sent when an upload or download begins.
+type TransferStarted struct {
+	Transfer
+}
+
+// TransferProgress is sent a few times a second while a file is copied.
+// Total is -1 when the sender didn't announce a size.
+type TransferProgress struct {
+	Name        string  `json:"name"`
+	Written     int64   `json:"written"`
+	Total       int64   `json:"total"`
+	BytesPerSec float64 `json:"bytesPerSec"`
+}
+
+// FileReceived is sent when an uploaded file has been saved. Name is the
+// final name relative to the upload directory, which differs from the sent
+// one when renamed on collision; Path is where it is on disk.
+type FileReceived struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// FileSkipped is sent when an upload is dropped because its name is taken.
+type FileSkipped struct {
+	Name      string    `json:"name"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// FileSent is sent when a shared file has been downloaded in full. SHA256
+// is empty for archives built on the fly.
+type FileSent struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// TransferFailed is sent when an upload was cut off and cleaned up, or a
+// download ended before the client had the whole file. Transfers a
+// shutdown cut off raise TransferAborted instead.
+type TransferFailed struct {
+	Name      string    `json:"name"`
+	Direction string    `json:"direction"` // "upload" or "download", as in Transfer
+	Reason    string    `json:"reason"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// IntegrityFailed is sent when a received file doesn't match its SHA-256.
+type IntegrityFailed struct {
+	Name      string    `json:"name"`
+	Expected  string    `json:"expected"`
+	Actual    string    `json:"actual"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// TransferAborted is sent for each transfer a shutdown had to cut off.
+type TransferAborted struct {
+	Transfer
+}
+
+// IncomingRequest is sent when a transfer waits for approval; answer it
+// with Approvals.Respond.
+type IncomingRequest struct {
+	ID     string         `json:"id"`
+	Device string         `json:"device"`
+	Files  []IncomingFile `json:"files"`
+}
+
+// IncomingRequestClosed is sent when a pending request goes away without
+// an answer. Reason is "timeout", "cancelled" or "shutdown".
+type IncomingRequestClosed struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// OfferAccepted is sent when a phone starts downloading an offered file.
+type OfferAccepted struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// OfferDeclined is sent when a phone turns an offered file down.
+type OfferDeclined struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (DeviceConnected) EventName() string       { return "device_connected" }
+func (DeviceDisconnected) EventName() string    { return "device_disconnected" }
+func (PairingRequired) EventName() string       { return "pairing_required" }
+func (Paired) EventName() string                { return "paired" }
+func (TransferStarted) EventName() string       { return "transfer_started" }
+func (TransferProgress) EventName() string      { return "upload_progress" }
+func (FileReceived) EventName() string          { return "file_received" }
+func (FileSkipped) EventName() string           { return "file_skipped" }
+func (FileSent) EventName() string              { return "file_sent" }
+func (TransferFailed) EventName() string        { return "file_failed" }
+func (IntegrityFailed) EventName() string       { return "integrity_failed" }
+func (TransferAborted) EventName() string       { return "transfer_aborted" }
+func (IncomingRequest) EventName() string       { return "incoming_request" }
+func (IncomingRequestClosed) EventName() string { return "incoming_request_closed" }
+func (OfferAccepted) EventName() string         { return "offer_accepted" }
+func (OfferDeclined) EventName() string         { return "offer_declined" }
+
+// MarshalEvent encodes e as {"instance": id, "event": name, "data": {...}};
+// instance is left out when empty.
+func MarshalEvent(instance string, e Event) ([]byte, error) {
+	return json.Marshal(struct {
+		Instance string `json:"instance,omitempty"`
+		Event    string `json:"event"`
+		Data     Event  `json:"data"`
+	}{instance, e.EventName(), e})
+}
+
+// DefaultEventBuffer is how many events a subscription queues before its
+// overflow policy kicks in.
+const DefaultEventBuffer = 256
+
+// OverflowPolicy decides what happens when a subscriber falls behind and
+// its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes emitters wait for room, so nothing is lost; a
+	// stalled subscriber stalls transfers until it catches up or closes.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropProgress discards TransferProgress events that don't fit
+	// and waits for room for everything else. Later progress supersedes
+	// what was dropped.
+	OverflowDropProgress
+)
+
+// SubscribeOptions configures Subscribe.
+type SubscribeOptions struct {
+	// Buffer is the queue length; 0 means DefaultEventBuffer.
+	Buffer int
+	// Overflow applies when the queue is full; the zero value blocks.
+	Overflow OverflowPolicy
+}
+
+// Subscription delivers events to one callback, one at a time. Events
+// raised by one transfer arrive in the order they were emitted; those of
+// concurrent transfers interleave.
+type Subscription struct {
+	bus      *eventBus
+	fn       func(instance string, e Event)
+	overflow OverflowPolicy
+	queue    chan taggedEvent
+	closing  chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	dropped  atomic.Int64
+}
+
+type taggedEvent struct {
+	instance string
+	event    Event
+}
+
+// eventBus fans events out to its subscribers. mu only guards the set, so
+// a subscriber with a full queue holds up the emitters waiting on it and
+// no one else.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]bool
+}
+
+// allEvents carries the events of every instance in the process.
+var allEvents = &eventBus{subs: make(map[*Subscription]bool)}
+
+// Subscribe calls fn for every event of every server in the process until
+// the subscription is closed; HTTPServer.Subscribe narrows it to one.
+// Calls never overlap, so fn needn't be safe for concurrent use, but it
+// should return promptly.
+func Subscribe(fn func(instance string, e Event), opts SubscribeOptions) *Subscription {
+	return allEvents.subscribe(fn, opts)
+}
+
+func (b *eventBus) subscribe(fn func(instance string, e Event), opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultEventBuffer
+	}
+	sub := &Subscription{
+		bus:      b,
+		fn:       fn,
+		overflow: opts.Overflow,
+		queue:    make(chan taggedEvent, opts.Buffer),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = true
+	b.mu.Unlock()
+	fmt.Println("🔧 Event subscriber registered")
+
+	go sub.run()
+	return sub
+}
+
+func (b *eventBus) publish(instance string, e Event) {
+	b.mu.Lock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.enqueue(taggedEvent{instance, e})
+	}
+}
+
+// Close stops the subscription. Events queued before Close are still
+// delivered; Done is closed after the last one. It is safe to call more
+// than once, and from inside the callback.
+func (s *Subscription) Close() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		// Release emitters blocked on a full queue
+		close(s.closing)
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+	})
+}
+
+// Done is closed once a closed subscription has delivered its queue.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped counts the events discarded by the overflow policy.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) run() {
+	defer close(s.done)
+	for {
+		select {
+		case t := <-s.queue:
+			s.deliver(t)
+		case <-s.closing:
+			for {
+				select {
+				case t := <-s.queue:
+					s.deliver(t)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver calls the callback; a panicking subscriber doesn't take the
+// server down or stop later events.
+func (s *Subscription) deliver(t taggedEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("⚠️ Event subscriber panic: %v\n", r)
+		}
+	}()
+	s.fn(t.instance, t.event)
+}
+
+// enqueue applies the overflow policy.
+func (s *Subscription) enqueue(t taggedEvent) {
+	// A closed subscription takes nothing more, even with room in its queue
+	select {
+	case <-s.closing:
+		return
+	default:
+	}
+	select {
+	case s.queue <- t:
+		return
+	case <-s.closing:
+		return
+	default:
+	}
+
+	if _, ok := t.event.(TransferProgress); ok && s.overflow == OverflowDropProgress {
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case s.queue <- t:
+	case <-s.closing:
+	}
+}
+
+// emitter raises one server instance's events, for its own subscribers
+// and the process-wide ones. A nil emitter raises untagged events.
+type emitter struct {
+	instance string
+	bus      *eventBus
+}
+
+func newEmitter(instance string) *emitter {
+	return &emitter{instance: instance, bus: &eventBus{subs: make(map[*Subscription]bool)}}
+}
+
+func (em *emitter) emit(e Event) {
+	// Subscribers do their own logging; progress alone would flood stdout
+	var instance string
+	if em != nil {
+		instance = em.instance
+		em.bus.publish(instance, e)
+	}
+	allEvents.publish(instance, e)
+}
+
+type emitterKey struct{}
+
+// withEmitter is the base context of a server's requests.
+func withEmitter(ctx context.Context, em *emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, em)
+}
+
+// eventsFor returns the emitter of the server handling r.
+func eventsFor(r *http.Request) *emitter {
+	em, _ := r.Context().Value(emitterKey{}).(*emitter)
+	return em
+}
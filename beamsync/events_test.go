@@ -0,0 +1,215 @@
+package beamsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog records, per file, the kinds of event a subscriber saw.
+type eventLog struct {
+	mu    sync.Mutex
+	files map[string][]string
+}
+
+func (l *eventLog) observe(_ string, e Event) {
+	var name, kind string
+	switch e := e.(type) {
+	case TransferStarted:
+		name, kind = e.Name, "started"
+	case TransferProgress:
+		name, kind = e.Name, "progress"
+	case FileReceived:
+		name, kind = e.Name, "received"
+	default:
+		return
+	}
+	l.mu.Lock()
+	l.files[name] = append(l.files[name], kind)
+	l.mu.Unlock()
+}
+
+// slowUpload sends one file in chunks spread over about a second, so the
+// receiver reports progress several times along the way.
+func slowUpload(url, name string) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("documents", name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for i := 0; i < 4; i++ {
+			if _, err := part.Write(bytes.Repeat([]byte{byte('a' + i)}, 32*1024)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			time.Sleep(300 * time.Millisecond)
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, url, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	// A kept-alive connection could outlive this test's server
+	req.Close = true
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// freePort returns a port the system just handed out, so tests don't
+// compete with whatever else is listening.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestEventOrderConcurrentUploads(t *testing.T) {
+	s := NewReceiver(ReceiverOptions{UploadDir: t.TempDir(), Port: freePort(t)})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	fast := &eventLog{files: make(map[string][]string)}
+	fastSub := s.Subscribe(fast.observe, SubscribeOptions{})
+
+	// The slow subscriber can't keep up with progress from every upload
+	slow := &eventLog{files: make(map[string][]string)}
+	slowSub := s.Subscribe(func(instance string, e Event) {
+		time.Sleep(100 * time.Millisecond)
+		slow.observe(instance, e)
+	}, SubscribeOptions{Buffer: 4, Overflow: OverflowDropProgress})
+
+	const uploads = 8
+	url := fmt.Sprintf("http://127.0.0.1:%d/upload", s.Port())
+	var wg sync.WaitGroup
+	errs := make(chan error, uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- slowUpload(url, fmt.Sprintf("file-%d.bin", i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sub := range []*Subscription{fastSub, slowSub} {
+		sub.Close()
+		<-sub.Done()
+	}
+
+	for i := 0; i < uploads; i++ {
+		name := fmt.Sprintf("file-%d.bin", i)
+		for label, log := range map[string]*eventLog{"fast": fast, "slow": slow} {
+			kinds := log.files[name]
+			if len(kinds) < 2 || kinds[0] != "started" || kinds[len(kinds)-1] != "received" {
+				t.Errorf("%s subscriber saw %s as %v; want started, progress..., received", label, name, kinds)
+				continue
+			}
+			for _, k := range kinds[1 : len(kinds)-1] {
+				if k != "progress" {
+					t.Errorf("%s subscriber saw %s as %v; want only progress in between", label, name, kinds)
+					break
+				}
+			}
+		}
+		if len(fast.files[name]) < 3 {
+			t.Errorf("fast subscriber saw no progress for %s: %v", name, fast.files[name])
+		}
+	}
+
+	if fastSub.Dropped() != 0 {
+		t.Errorf("blocking subscriber dropped %d events", fastSub.Dropped())
+	}
+	if slowSub.Dropped() == 0 {
+		t.Error("slow subscriber dropped nothing; the test didn't overflow it")
+	}
+	var fastCount, slowCount int
+	for name := range fast.files {
+		fastCount += len(fast.files[name])
+		slowCount += len(slow.files[name])
+	}
+	if lost := int64(fastCount - slowCount); lost != slowSub.Dropped() {
+		t.Errorf("slow subscriber is missing %d events but dropped %d progress events", lost, slowSub.Dropped())
+	}
+}
+
+func TestSubscriptionCloseDeliversQueued(t *testing.T) {
+	em := newEmitter("test")
+	var got []Event
+	release := make(chan struct{})
+	sub := em.bus.subscribe(func(_ string, e Event) {
+		<-release
+		got = append(got, e)
+	}, SubscribeOptions{})
+
+	for i := 0; i < 3; i++ {
+		em.emit(Paired{IP: fmt.Sprint(i)})
+	}
+	sub.Close()
+	em.emit(Paired{IP: "after close"})
+	close(release)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Done not closed after Close")
+	}
+	if len(got) != 3 {
+		t.Fatalf("delivered %d events, want the 3 queued before Close", len(got))
+	}
+	for i, e := range got {
+		if e.(Paired).IP != fmt.Sprint(i) {
+			t.Errorf("event %d is %+v; out of order", i, e)
+		}
+	}
+	sub.Close() // closing twice is fine
+}
+
+func TestSubscriptionCloseFromCallback(t *testing.T) {
+	em := newEmitter("test")
+	var sub *Subscription
+	ready := make(chan struct{})
+	sub = em.bus.subscribe(func(string, Event) {
+		<-ready
+		sub.Close()
+	}, SubscribeOptions{})
+	close(ready)
+
+	em.emit(Paired{IP: "1"})
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("closing from the callback deadlocked")
+	}
+}
@@ -2,16 +2,20 @@ module beamsync
 
 go 1.25.5
 
-require github.com/gofiber/fiber/v2 v2.52.10
+require (
+	github.com/faiface/beep v1.1.0
+	github.com/gofiber/fiber/v2 v2.52.10
+)
 
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
-	github.com/faiface/beep v1.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/hajimehoshi/oto v0.7.1 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.51.0 // indirect
@@ -0,0 +1,253 @@
+package beamsync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is one file that was received or sent, successfully or not.
+type HistoryEntry struct {
+	ID        string `json:"id"`
+	Direction string `json:"direction"` // "received" or "sent"
+	Name      string `json:"name"`
+	// Path is the file on this computer: where it was saved, or what was
+	// shared. Empty when nothing was kept.
+	Path      string    `json:"path,omitempty"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	// Outcome is "completed", "failed", "aborted" (cut off by a shutdown),
+	// "skipped" (name taken) or "corrupted" (SHA-256 mismatch); Error says
+	// why for all but the first
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// maxHistoryEntries bounds the history; the oldest entries go first. The
+// file may run historySlack entries over before it is compacted, so most
+// additions are a plain append.
+const (
+	maxHistoryEntries = 5000
+	historySlack      = 500
+)
+
+// History is a transfer log kept as JSON lines in one file, so it survives
+// restarts without a database. A nil *History records nothing.
+type History struct {
+	path string
+
+	mu      sync.Mutex
+	entries []HistoryEntry // oldest first
+}
+
+// OpenHistory loads the history at path, creating its directory. Lines
+// that can't be parsed, such as one cut short by a crash, are skipped.
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	h := &History{path: path}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			fmt.Println("⚠️ Skipping unreadable history entry:", err)
+			continue
+		}
+		h.entries = append(h.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("📜 Loaded %d history entries from %s\n", len(h.entries), path)
+	return h, nil
+}
+
+// Add appends an entry, filling in its ID and EndedAt if unset.
+func (h *History) Add(e HistoryEntry) error {
+	if h == nil {
+		return nil
+	}
+	if e.ID == "" {
+		id, err := randomHex(8)
+		if err != nil {
+			return err
+		}
+		e.ID = id
+	}
+	if e.EndedAt.IsZero() {
+		e.EndedAt = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, e)
+	if len(h.entries) > maxHistoryEntries+historySlack {
+		h.entries = append([]HistoryEntry(nil), h.entries[len(h.entries)-maxHistoryEntries:]...)
+		return h.rewrite()
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the file with the entries in memory; the caller holds mu.
+func (h *History) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range h.entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), h.path)
+}
+
+// List returns every entry, newest first.
+func (h *History) List() []HistoryEntry {
+	return h.Search("")
+}
+
+// Search returns the entries, newest first, whose name, path, device,
+// direction or outcome contain every word of query, ignoring case.
+func (h *History) Search(query string) []HistoryEntry {
+	if h == nil {
+		return nil
+	}
+	terms := strings.Fields(strings.ToLower(query))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]HistoryEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		haystack := strings.ToLower(strings.Join([]string{e.Name, e.Path, e.Device, e.Direction, e.Outcome}, "\n"))
+		match := true
+		for _, term := range terms {
+			if !strings.Contains(haystack, term) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Get finds an entry by ID.
+func (h *History) Get(id string) (HistoryEntry, bool) {
+	if h == nil {
+		return HistoryEntry{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// Clear forgets every entry. Files on disk are left alone.
+func (h *History) Clear() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+	return os.WriteFile(h.path, nil, 0600)
+}
+
+// Observe records finished, failed, aborted and skipped files from server
+// events, in both directions; pass it to Subscribe or HTTPServer.Subscribe.
+func (h *History) Observe(_ string, e Event) {
+	var entry HistoryEntry
+	switch e := e.(type) {
+	case FileReceived:
+		entry = HistoryEntry{Direction: "received", Name: e.Name, Path: e.Path, Size: e.Size, SHA256: e.SHA256,
+			Device: e.Device, StartedAt: e.StartedAt, Outcome: "completed"}
+	case FileSent:
+		entry = HistoryEntry{Direction: "sent", Name: e.Name, Path: e.Path, Size: e.Size, SHA256: e.SHA256,
+			Device: e.Device, StartedAt: e.StartedAt, Outcome: "completed"}
+	case FileSkipped:
+		entry = HistoryEntry{Direction: "received", Name: e.Name, Device: e.Device, StartedAt: e.StartedAt,
+			Outcome: "skipped", Error: "a file with this name already exists"}
+	case TransferFailed:
+		entry = HistoryEntry{Direction: historyDirection(e.Direction), Name: e.Name, Device: e.Device,
+			StartedAt: e.StartedAt, Outcome: "failed", Error: e.Reason}
+	case TransferAborted:
+		entry = HistoryEntry{Direction: historyDirection(e.Direction), Name: e.Name, Device: e.Device,
+			StartedAt: e.StartedAt, Outcome: "aborted", Error: "cut off by shutdown"}
+	case IntegrityFailed:
+		entry = HistoryEntry{Direction: "received", Name: e.Name, SHA256: e.Actual, Device: e.Device,
+			StartedAt: e.StartedAt, Outcome: "corrupted", Error: "expected SHA-256 " + e.Expected}
+	default:
+		return
+	}
+	if err := h.Add(entry); err != nil {
+		fmt.Println("⚠️ Failed to record history:", err)
+	}
+}
+
+// historyDirection maps a Transfer direction to a HistoryEntry one.
+func historyDirection(transfer string) string {
+	if transfer == "download" {
+		return "sent"
+	}
+	return "received"
+}
@@ -0,0 +1,171 @@
+package beamsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T, path string) *History {
+	t.Helper()
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestHistoryReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "history.jsonl")
+	h := openTestHistory(t, path)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := h.Add(HistoryEntry{Direction: "received", Name: name, Outcome: "completed"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := openTestHistory(t, path).List()
+	if len(got) != 2 || got[0].Name != "b.txt" || got[1].Name != "a.txt" {
+		t.Fatalf("reloaded %+v, want b.txt then a.txt", got)
+	}
+	if got[0].ID == "" || got[0].EndedAt.IsZero() {
+		t.Errorf("ID or EndedAt not filled in: %+v", got[0])
+	}
+	if e, ok := openTestHistory(t, path).Get(got[1].ID); !ok || e.Name != "a.txt" {
+		t.Errorf("Get(%q) = %+v, %v", got[1].ID, e, ok)
+	}
+}
+
+func TestHistorySkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	data := `{"id":"1","name":"good.txt","outcome":"completed"}
+not json at all
+{"id":"2","name":"cut short`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got := openTestHistory(t, path).List()
+	if len(got) != 1 || got[0].Name != "good.txt" {
+		t.Errorf("loaded %+v, want only good.txt", got)
+	}
+}
+
+func TestHistoryTrimsInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h := openTestHistory(t, path)
+	add := func(i int) {
+		if err := h.Add(HistoryEntry{ID: fmt.Sprint(i), Name: fmt.Sprintf("f%d", i), EndedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limit := maxHistoryEntries + historySlack
+	for i := 0; i < limit; i++ {
+		add(i)
+	}
+	if n := countLines(t, path); n != limit {
+		t.Fatalf("file has %d lines before compaction, want %d", n, limit)
+	}
+
+	add(limit)
+	if n := countLines(t, path); n != maxHistoryEntries {
+		t.Errorf("file has %d lines after compaction, want %d", n, maxHistoryEntries)
+	}
+	got := openTestHistory(t, path).List()
+	if len(got) != maxHistoryEntries {
+		t.Fatalf("reloaded %d entries, want %d", len(got), maxHistoryEntries)
+	}
+	if got[0].ID != fmt.Sprint(limit) || got[len(got)-1].ID != fmt.Sprint(limit-maxHistoryEntries+1) {
+		t.Errorf("kept %s..%s, want the newest %d", got[len(got)-1].ID, got[0].ID, maxHistoryEntries)
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := openTestHistory(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	for _, e := range []HistoryEntry{
+		{Name: "Holiday.JPG", Device: "Pixel 8", Direction: "received", Outcome: "completed"},
+		{Name: "report.pdf", Device: "Pixel 8", Direction: "sent", Outcome: "failed"},
+		{Name: "holiday.mov", Device: "iPhone", Direction: "received", Outcome: "completed"},
+	} {
+		if err := h.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"holiday.mov", "report.pdf", "Holiday.JPG"}},
+		{"HOLIDAY", []string{"holiday.mov", "Holiday.JPG"}},
+		{"holiday pixel", []string{"Holiday.JPG"}},
+		{"sent failed", []string{"report.pdf"}},
+		{"nothing", nil},
+	} {
+		var names []string
+		for _, e := range h.Search(c.query) {
+			names = append(names, e.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(c.want) {
+			t.Errorf("Search(%q) = %v, want %v", c.query, names, c.want)
+		}
+	}
+}
+
+func TestHistoryClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h := openTestHistory(t, path)
+	if err := h.Add(HistoryEntry{Name: "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.List(); len(got) != 0 {
+		t.Errorf("%d entries after Clear", len(got))
+	}
+	if got := openTestHistory(t, path).List(); len(got) != 0 {
+		t.Errorf("%d entries reloaded after Clear", len(got))
+	}
+}
+
+func TestHistoryObserve(t *testing.T) {
+	h := openTestHistory(t, filepath.Join(t.TempDir(), "history.jsonl"))
+	started := time.Now().Add(-time.Minute)
+	h.Observe("receiver", FileSkipped{Name: "dup.txt", StartedAt: started})
+	h.Observe("sender", TransferAborted{Transfer{Name: "big.iso", Direction: "download", StartedAt: started}})
+	h.Observe("sender", TransferFailed{Name: "doc.pdf", Direction: "download", Reason: "reset", StartedAt: started})
+	h.Observe("receiver", TransferProgress{Name: "ignored"})
+
+	got := h.List()
+	want := []struct{ name, direction, outcome string }{
+		{"doc.pdf", "sent", "failed"},
+		{"big.iso", "sent", "aborted"},
+		{"dup.txt", "received", "skipped"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("recorded %+v", got)
+	}
+	for i, w := range want {
+		e := got[i]
+		if e.Name != w.name || e.Direction != w.direction || e.Outcome != w.outcome {
+			t.Errorf("entry %d is %s/%s/%s, want %s/%s/%s", i, e.Name, e.Direction, e.Outcome, w.name, w.direction, w.outcome)
+		}
+		if !e.StartedAt.Equal(started) {
+			t.Errorf("%s started at %v, want %v", e.Name, e.StartedAt, started)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package beamsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatusChecksumMismatch is returned when a received file doesn't match the
+// SHA-256 announced by the sender. The code matches the tus checksum extension.
+const StatusChecksumMismatch = 460
+
+// checksumError describes a SHA-256 mismatch on a received file.
+type checksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("sha256 mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// normalizeSHA256 lowercases a hex digest and rejects anything malformed.
+// An empty string means the sender didn't provide a hash.
+func normalizeSHA256(sum string) (string, error) {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	if sum == "" {
+		return "", nil
+	}
+	if len(sum) != sha256.Size*2 {
+		return "", errors.New("invalid sha256 length")
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// verifySHA256 compares a computed digest with the expected one, if any.
+func verifySHA256(expected, actual string) error {
+	if expected == "" || expected == actual {
+		return nil
+	}
+	return &checksumError{Expected: expected, Actual: actual}
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// emitIntegrityFailed reports a checksum mismatch.
+func emitIntegrityFailed(r *http.Request, filename string, started time.Time, err *checksumError) {
+	fmt.Printf("🚫 Integrity check failed for %s: %v\n", filename, err)
+	eventsFor(r).emit(IntegrityFailed{Name: filename, Expected: err.Expected, Actual: err.Actual,
+		Device: deviceName(r), StartedAt: started})
+}
+
+// fileDigest lazily hashes a shared file once and caches the result.
+type fileDigest struct {
+	path string
+	once sync.Once
+	done atomic.Bool
+	sum  string
+	err  error
+}
+
+func newFileDigests(paths []string) []*fileDigest {
+	digests := make([]*fileDigest, len(paths))
+	for i, path := range paths {
+		digests[i] = &fileDigest{path: path}
+	}
+	return digests
+}
+
+// SHA256 hashes the file on first use and blocks until the digest is known.
+func (d *fileDigest) SHA256() (string, error) {
+	d.once.Do(func() {
+		d.sum, d.err = hashFile(d.path)
+		d.done.Store(true)
+	})
+	return d.sum, d.err
+}
+
+// Cached returns the digest only if it has already been computed.
+func (d *fileDigest) Cached() (string, bool) {
+	if !d.done.Load() || d.err != nil {
+		return "", false
+	}
+	return d.sum, true
+}
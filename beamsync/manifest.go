@@ -0,0 +1,88 @@
+package beamsync
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// manifestEntry describes one shared file in /manifest.json so clients can
+// verify what they downloaded.
+type manifestEntry struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	URL    string `json:"url"`
+	Browse string `json:"browse,omitempty"`
+}
+
+// manifestHandler lists every shared file with its SHA-256. Hashes are
+// computed once per file and cached for the lifetime of the sender.
+// Directories are listed without a hash; their URL streams an archive.
+func manifestHandler(filePaths []string, isDir []bool, digests []*fileDigest, urlFor func(i int) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries := make([]manifestEntry, 0, len(filePaths))
+		for i, path := range filePaths {
+			stat, err := os.Stat(path)
+			if err != nil {
+				http.Error(w, "File unavailable", http.StatusInternalServerError)
+				return
+			}
+			if isDir[i] {
+				entries = append(entries, manifestEntry{
+					Index:  i,
+					Name:   filepath.Base(path),
+					Type:   "directory",
+					URL:    urlFor(i),
+					Browse: fmt.Sprintf("/browse/%d/", i),
+				})
+				continue
+			}
+
+			sum, err := digests[i].SHA256()
+			if err != nil {
+				fmt.Println("❌ Failed to hash shared file:", err)
+				http.Error(w, "Hashing failed", http.StatusInternalServerError)
+				return
+			}
+			entries = append(entries, manifestEntry{
+				Index:  i,
+				Name:   filepath.Base(path),
+				Type:   "file",
+				Size:   stat.Size(),
+				SHA256: sum,
+				URL:    urlFor(i),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": entries})
+	}
+}
+
+// setDigestHeaders advertises a file's hash on its download response when it
+// has already been computed; downloads never wait for hashing.
+func setDigestHeaders(w http.ResponseWriter, d *fileDigest) {
+	sum, ok := d.Cached()
+	if !ok {
+		return
+	}
+	raw, err := hex.DecodeString(sum)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(raw)+":")
+	w.Header().Set("X-Checksum-Sha256", sum)
+}
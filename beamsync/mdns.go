@@ -0,0 +1,444 @@
+package beamsync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Running servers are advertised over multicast DNS as _beamsync._tcp and
+// _http._tcp, so apps and other desktops can find them without the QR code.
+// The responder runs in-process; no system mDNS daemon is needed.
+
+const (
+	mdnsPort          = 5353
+	beamsyncService   = "_beamsync._tcp.local."
+	httpService       = "_http._tcp.local."
+	servicesEnumerate = "_services._dns-sd._udp.local."
+
+	// RFC 6762 recommends 120s for records naming hosts and 75 minutes
+	// for the rest
+	mdnsHostTTL    = 120
+	mdnsServiceTTL = 4500
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// mdnsResponder answers queries for one running server.
+type mdnsResponder struct {
+	conn     *net.UDPConn
+	instance string // unescaped instance label
+	host     string // e.g. "beamsync-laptop.local."
+	port     uint16
+	txt      []string
+	ifi      *net.Interface
+	ips      []net.IP // announced; queries get ipsFor's
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var (
+	instanceNamesMu sync.Mutex
+	instanceNames   = make(map[string]bool)
+)
+
+// claimInstanceName keeps the names of servers in this process unique,
+// numbering later ones "Name (2)", "Name (3)" as DNS-SD does.
+func claimInstanceName(base string) string {
+	instanceNamesMu.Lock()
+	defer instanceNamesMu.Unlock()
+	name := base
+	for n := 2; instanceNames[name]; n++ {
+		name = fmt.Sprintf("%s (%d)", base, n)
+	}
+	instanceNames[name] = true
+	return name
+}
+
+func releaseInstanceName(name string) {
+	instanceNamesMu.Lock()
+	delete(instanceNames, name)
+	instanceNamesMu.Unlock()
+}
+
+// startMDNS advertises a server on ifi, or on the system's default
+// multicast interface when ifi is nil.
+func startMDNS(ifi *net.Interface, role string, port int, identity *TLSIdentity) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", ifi, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	// Go turns multicast loopback off; other apps on this machine
+	// (and another BeamSync) should still see us
+	if err := enableMulticastLoopback(conn); err != nil {
+		fmt.Println("⚠️ mDNS loopback unavailable:", err)
+	}
+
+	hostname := localHostname()
+	m := &mdnsResponder{
+		conn:     conn,
+		instance: claimInstanceName(fmt.Sprintf("BeamSync %s on %s", strings.ToUpper(role[:1])+role[1:], hostname)),
+		host:     "beamsync-" + dnsSafeHost(hostname) + ".local.",
+		port:     uint16(port),
+		txt: []string{
+			"txtvers=1",
+			"role=" + role,
+			"name=" + hostname,
+			"scheme=" + identity.Scheme(),
+			"path=/",
+		},
+		ifi:  ifi,
+		ips:  advertisedIPs(ifi),
+		done: make(chan struct{}),
+	}
+	if fp := identity.Fingerprint(); fp != "" {
+		m.txt = append(m.txt, "fp="+fp)
+	}
+
+	m.wg.Add(2)
+	go m.serve()
+	go m.announce()
+
+	fmt.Printf("📣 mDNS: advertising %q on port %d\n", m.instance, port)
+	return m, nil
+}
+
+// Close withdraws the records with a goodbye packet and stops answering.
+func (m *mdnsResponder) Close() error {
+	if m == nil {
+		return nil
+	}
+	select {
+	case <-m.done:
+		return nil
+	default:
+	}
+	close(m.done)
+
+	m.send(&dnsMessage{
+		Flags:   dnsFlagResponse | dnsFlagAuthoritative,
+		Answers: m.allRecords(0),
+	}, mdnsGroup)
+	err := m.conn.Close()
+	m.wg.Wait()
+	releaseInstanceName(m.instance)
+	fmt.Printf("📣 mDNS: withdrew %q\n", m.instance)
+	return err
+}
+
+// announce sends the records unsolicited twice, a second apart, so
+// browsers already listening pick the service up straight away.
+func (m *mdnsResponder) announce() {
+	defer m.wg.Done()
+	for i := 0; i < 2; i++ {
+		m.send(&dnsMessage{
+			Flags:   dnsFlagResponse | dnsFlagAuthoritative,
+			Answers: m.allRecords(1),
+		}, mdnsGroup)
+		select {
+		case <-m.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (m *mdnsResponder) serve() {
+	defer m.wg.Done()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			fmt.Println("⚠️ mDNS read error:", err)
+			return
+		}
+
+		query, err := parseDNSMessage(buf[:n])
+		if err != nil || query.Flags&dnsFlagResponse != 0 {
+			continue
+		}
+
+		ips := m.ipsFor(from.IP)
+		var answers []dnsRecord
+		unicast := true
+		for _, q := range query.Questions {
+			answers = append(answers, m.answer(q, ips)...)
+			if q.Class&dnsClassTopBit == 0 {
+				unicast = false
+			}
+		}
+		if len(answers) == 0 {
+			continue
+		}
+
+		resp := &dnsMessage{
+			Flags:      dnsFlagResponse | dnsFlagAuthoritative,
+			Answers:    answers,
+			Additional: m.additional(answers, ips),
+		}
+		switch {
+		case from.Port != mdnsPort:
+			// Legacy unicast query (e.g. dig -p 5353): answer like plain DNS
+			resp.ID = query.ID
+			resp.Questions = query.Questions
+			for _, section := range [][]dnsRecord{resp.Answers, resp.Additional} {
+				for i := range section {
+					section[i].Class &^= dnsClassTopBit
+					section[i].TTL = min(section[i].TTL, 10)
+				}
+			}
+			m.send(resp, from)
+		case unicast:
+			m.send(resp, from)
+		default:
+			m.send(resp, mdnsGroup)
+		}
+	}
+}
+
+func (m *mdnsResponder) send(msg *dnsMessage, to *net.UDPAddr) {
+	b, err := msg.pack()
+	if err != nil {
+		fmt.Println("⚠️ mDNS pack error:", err)
+		return
+	}
+	// A late announcement may race Close; that's fine
+	if _, err := m.conn.WriteToUDP(b, to); err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Println("⚠️ mDNS send error:", err)
+	}
+}
+
+func (m *mdnsResponder) instanceName(service string) string {
+	return escapeDNSLabel(m.instance) + "." + service
+}
+
+// answer returns the records matching one question, giving ips as our
+// addresses.
+func (m *mdnsResponder) answer(q dnsQuestion, ips []net.IP) []dnsRecord {
+	var out []dnsRecord
+	wants := func(t uint16) bool { return q.Type == t || q.Type == dnsTypeANY }
+
+	for _, service := range []string{beamsyncService, httpService} {
+		if wants(dnsTypePTR) && sameDNSName(q.Name, service) {
+			out = append(out, m.ptr(service, 1))
+		}
+		if sameDNSName(q.Name, m.instanceName(service)) {
+			if wants(dnsTypeSRV) {
+				out = append(out, m.srv(service, 1))
+			}
+			if wants(dnsTypeTXT) {
+				out = append(out, m.text(service, 1))
+			}
+		}
+		if wants(dnsTypePTR) && sameDNSName(q.Name, servicesEnumerate) {
+			out = append(out, dnsRecord{Name: servicesEnumerate, Type: dnsTypePTR, Class: dnsClassIN, TTL: mdnsServiceTTL, Target: service})
+		}
+	}
+	if wants(dnsTypeA) && sameDNSName(q.Name, m.host) {
+		out = append(out, m.addresses(ips, 1)...)
+	}
+	return out
+}
+
+// additional supplies the SRV, TXT and address records a browser will
+// need next, saving it another round trip.
+func (m *mdnsResponder) additional(answers []dnsRecord, ips []net.IP) []dnsRecord {
+	var out []dnsRecord
+	hasAddr := false
+	for _, a := range answers {
+		hasAddr = hasAddr || a.Type == dnsTypeA
+		if a.Type != dnsTypePTR || sameDNSName(a.Name, servicesEnumerate) {
+			continue
+		}
+		service := beamsyncService
+		if sameDNSName(a.Name, httpService) {
+			service = httpService
+		}
+		out = append(out, m.srv(service, 1), m.text(service, 1))
+	}
+	if len(out) > 0 && !hasAddr {
+		out = append(out, m.addresses(ips, 1)...)
+	}
+	return out
+}
+
+// allRecords is everything we own; ttlScale 0 turns it into a goodbye.
+func (m *mdnsResponder) allRecords(ttlScale uint32) []dnsRecord {
+	var out []dnsRecord
+	for _, service := range []string{beamsyncService, httpService} {
+		out = append(out, m.ptr(service, ttlScale), m.srv(service, ttlScale), m.text(service, ttlScale))
+	}
+	return append(out, m.addresses(m.ips, ttlScale)...)
+}
+
+func (m *mdnsResponder) ptr(service string, ttlScale uint32) dnsRecord {
+	return dnsRecord{Name: service, Type: dnsTypePTR, Class: dnsClassIN, TTL: mdnsServiceTTL * ttlScale, Target: m.instanceName(service)}
+}
+
+func (m *mdnsResponder) srv(service string, ttlScale uint32) dnsRecord {
+	return dnsRecord{Name: m.instanceName(service), Type: dnsTypeSRV, Class: dnsClassIN | dnsClassTopBit, TTL: mdnsHostTTL * ttlScale, Port: m.port, Target: m.host}
+}
+
+func (m *mdnsResponder) text(service string, ttlScale uint32) dnsRecord {
+	return dnsRecord{Name: m.instanceName(service), Type: dnsTypeTXT, Class: dnsClassIN | dnsClassTopBit, TTL: mdnsServiceTTL * ttlScale, Text: m.txt}
+}
+
+func (m *mdnsResponder) addresses(ips []net.IP, ttlScale uint32) []dnsRecord {
+	out := make([]dnsRecord, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, dnsRecord{Name: m.host, Type: dnsTypeA, Class: dnsClassIN | dnsClassTopBit, TTL: mdnsHostTTL * ttlScale, IP: ip})
+	}
+	return out
+}
+
+// advertisedIPs lists the IPv4 addresses to announce: those of ifi, or
+// the LAN address when ifi is nil. Docker and VPN bridges are left out,
+// since a peer that picked one of those couldn't reach us.
+func advertisedIPs(ifi *net.Interface) []net.IP {
+	if ifi == nil {
+		if ip := lanIP(); ip != nil {
+			return []net.IP{ip}
+		}
+		return []net.IP{net.IPv4(127, 0, 0, 1).To4()}
+	}
+
+	addrs, _ := ifi.Addrs()
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	if len(ips) == 0 {
+		ips = append(ips, net.IPv4(127, 0, 0, 1).To4())
+	}
+	return ips
+}
+
+// ipsFor answers a query from src with our addresses on src's subnet, the
+// ones it can reach, falling back to the announced addresses.
+func (m *mdnsResponder) ipsFor(src net.IP) []net.IP {
+	var addrs []net.Addr
+	if m.ifi != nil {
+		addrs, _ = m.ifi.Addrs()
+	} else {
+		addrs, _ = net.InterfaceAddrs()
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.To4() != nil && ipNet.Contains(src) {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	if len(ips) == 0 {
+		return m.ips
+	}
+	return ips
+}
+
+// lanIP is this machine's IPv4 address on the local network, or nil if it
+// has none. It reads the interfaces rather than asking for a route out, so
+// it works on a LAN without internet access.
+func lanIP() net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var addrs []net.Addr
+	for _, ifi := range ifaces {
+		if lanInterface(ifi) {
+			ifiAddrs, _ := ifi.Addrs()
+			addrs = append(addrs, ifiAddrs...)
+		}
+	}
+	return pickLANIP(addrs)
+}
+
+// virtualInterfaces are name prefixes of container and VM bridges, which
+// phones can't reach.
+var virtualInterfaces = []string{"docker", "br-", "veth", "virbr", "vmnet", "vboxnet", "lxcbr", "lxdbr",
+	"cni", "flannel", "podman", "vethernet", "virtualbox", "vmware"}
+
+// lanInterface reports whether ifi could face the local network: up, not
+// loopback, not a point-to-point VPN tunnel and not a virtual bridge.
+func lanInterface(ifi net.Interface) bool {
+	if ifi.Flags&net.FlagUp == 0 || ifi.Flags&(net.FlagLoopback|net.FlagPointToPoint) != 0 {
+		return false
+	}
+	name := strings.ToLower(ifi.Name)
+	for _, prefix := range virtualInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// pickLANIP returns the first private IPv4 address in addrs, else the
+// first other routable one. Link-local addresses are what a machine gives
+// itself without DHCP, so they only count as a last resort.
+func pickLANIP(addrs []net.Addr) net.IP {
+	var public, linkLocal net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		ip := ipNet.IP.To4()
+		switch {
+		case ip.IsPrivate():
+			return ip
+		case ip.IsLinkLocalUnicast():
+			if linkLocal == nil {
+				linkLocal = ip
+			}
+		case ip.IsGlobalUnicast() && public == nil:
+			public = ip
+		}
+	}
+	if public != nil {
+		return public
+	}
+	return linkLocal
+}
+
+func localHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "desktop"
+	}
+	hostname, _, _ = strings.Cut(hostname, ".")
+	return hostname
+}
+
+// dnsSafeHost reduces a hostname to letters, digits and hyphens.
+func dnsSafeHost(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	s := strings.Trim(b.String(), "-")
+	if s == "" {
+		s = "desktop"
+	}
+	if len(s) > 50 {
+		s = s[:50]
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package beamsync
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestDiscoverPeersLoopback advertises a responder and finds it again from
+// the same machine, relying on multicast loopback.
+func TestDiscoverPeersLoopback(t *testing.T) {
+	port := freePort(t)
+	m, err := startMDNS(nil, "receiver", port, nil)
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer m.Close()
+
+	peers, err := DiscoverPeers(context.Background(), 1500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *Peer
+	for i := range peers {
+		if peers[i].ID == m.instance {
+			found = &peers[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("responder %q not discovered; got %+v", m.instance, peers)
+	}
+	if found.Port != port || found.Role != "receiver" || found.Scheme != "http" {
+		t.Errorf("unexpected peer %+v", *found)
+	}
+	if ip := net.ParseIP(found.Address); ip == nil || !isLocalIP(ip) {
+		t.Errorf("peer address %q is not one of ours", found.Address)
+	}
+}
+
+// TestIPsForQuerySubnet checks answers carry only the address on the
+// querier's subnet.
+func TestIPsForQuerySubnet(t *testing.T) {
+	m := &mdnsResponder{ips: []net.IP{net.IPv4(192, 0, 2, 2).To4()}}
+
+	got := m.ipsFor(net.IPv4(127, 0, 0, 1))
+	if len(got) != 1 || !got[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("loopback query answered with %v", got)
+	}
+
+	// Nothing of ours is on a documentation-only range; fall back
+	got = m.ipsFor(net.IPv4(203, 0, 113, 9))
+	if len(got) != 1 || !got[0].Equal(m.ips[0]) {
+		t.Errorf("foreign query answered with %v, want %v", got, m.ips)
+	}
+}
+
+func TestLANInterface(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast | net.FlagMulticast
+	for _, c := range []struct {
+		ifi  net.Interface
+		want bool
+	}{
+		{net.Interface{Name: "eth0", Flags: up}, true},
+		{net.Interface{Name: "wlp2s0", Flags: up}, true},
+		{net.Interface{Name: "Wi-Fi", Flags: up}, true},
+		{net.Interface{Name: "eth1", Flags: net.FlagBroadcast}, false},
+		{net.Interface{Name: "lo", Flags: net.FlagUp | net.FlagLoopback}, false},
+		{net.Interface{Name: "tun0", Flags: net.FlagUp | net.FlagPointToPoint}, false},
+		{net.Interface{Name: "docker0", Flags: up}, false},
+		{net.Interface{Name: "br-3f2a9c", Flags: up}, false},
+		{net.Interface{Name: "veth1a2b", Flags: up}, false},
+		{net.Interface{Name: "virbr0", Flags: up}, false},
+		{net.Interface{Name: "vEthernet (WSL)", Flags: up}, false},
+	} {
+		if got := lanInterface(c.ifi); got != c.want {
+			t.Errorf("lanInterface(%s) = %v, want %v", c.ifi.Name, got, c.want)
+		}
+	}
+}
+
+func TestPickLANIP(t *testing.T) {
+	addr := func(ip string) net.Addr {
+		return &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(24, 32)}
+	}
+	for _, c := range []struct {
+		addrs []net.Addr
+		want  string
+	}{
+		{[]net.Addr{addr("fe80::1"), addr("192.168.1.20")}, "192.168.1.20"},
+		{[]net.Addr{addr("169.254.3.4"), addr("203.0.113.7"), addr("10.0.0.5")}, "10.0.0.5"},
+		{[]net.Addr{addr("169.254.3.4"), addr("203.0.113.7")}, "203.0.113.7"},
+		{[]net.Addr{addr("169.254.3.4")}, "169.254.3.4"},
+		{[]net.Addr{addr("fe80::1")}, "<nil>"},
+		{nil, "<nil>"},
+	} {
+		if got := pickLANIP(c.addrs); got.String() != c.want {
+			t.Errorf("pickLANIP(%v) = %v, want %s", c.addrs, got, c.want)
+		}
+	}
+}
+
+func isLocalIP(ip net.IP) bool {
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package beamsync
+
+import (
+	"net"
+	"syscall"
+)
+
+func enableMulticastLoopback(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
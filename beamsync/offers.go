@@ -0,0 +1,173 @@
+package beamsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Offers let the desktop push files to a phone that already has the
+// receiver page open. The offer travels down the page's event stream, the
+// page asks "Download X?", and the file is served from the receiver's own
+// port under /offers/{id}, so one session works in both directions.
+
+// ErrDeviceUnreachable means the device has no open event stream to carry
+// an offer, e.g. its page closed or fell back to heartbeats.
+var ErrDeviceUnreachable = errors.New("device is not reachable")
+
+const offersPath = "/offers/"
+
+// offerTTL is how long an offer stays open. One downloaded in full goes
+// at once.
+const offerTTL = 24 * time.Hour
+
+type fileOffer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Folder   bool   `json:"folder"`
+	URL      string `json:"url"`
+	path     string
+	deviceID string
+	digest   *fileDigest // nil for folders
+	expires  time.Time
+}
+
+type offerStore struct {
+	devices   *deviceTracker
+	transfers *transferTracker
+
+	mu     sync.Mutex
+	offers map[string]*fileOffer
+}
+
+func newOfferStore(devices *deviceTracker, transfers *transferTracker) *offerStore {
+	return &offerStore{devices: devices, transfers: transfers, offers: make(map[string]*fileOffer)}
+}
+
+// OfferFile pushes a download offer for filePath to one device, or to every
+// connected device when deviceID is empty. Folders are offered as a zip.
+func (s *HTTPServer) OfferFile(deviceID, filePath string) error {
+	if s == nil || s.offers == nil {
+		return errors.New("offers need a running receiver")
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	targets := []string{deviceID}
+	if deviceID == "" {
+		targets = targets[:0]
+		for _, d := range s.devices.List() {
+			targets = append(targets, d.ID)
+		}
+	}
+
+	sent := 0
+	for _, target := range targets {
+		if s.offers.push(target, filePath, info) {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return ErrDeviceUnreachable
+	}
+	return nil
+}
+
+func (o *offerStore) push(deviceID, filePath string, info os.FileInfo) bool {
+	id, err := randomHex(8)
+	if err != nil {
+		return false
+	}
+	offer := &fileOffer{
+		ID:       id,
+		Name:     info.Name(),
+		Size:     info.Size(),
+		Folder:   info.IsDir(),
+		URL:      offersPath + id,
+		path:     filePath,
+		deviceID: deviceID,
+		expires:  time.Now().Add(offerTTL),
+	}
+	if offer.Folder {
+		offer.Name += ".zip"
+		offer.Size = -1
+	} else {
+		offer.digest = &fileDigest{path: filePath}
+	}
+
+	payload, _ := json.Marshal(offer)
+	o.mu.Lock()
+	for oldID, old := range o.offers {
+		if time.Now().After(old.expires) {
+			delete(o.offers, oldID)
+		}
+	}
+	o.offers[id] = offer
+	o.mu.Unlock()
+
+	if !o.devices.Push(deviceID, streamMessage{Event: "offer", Data: string(payload)}) {
+		o.remove(id)
+		return false
+	}
+	fmt.Printf("📨 Offered %s to %s\n", offer.Name, deviceID)
+	return true
+}
+
+func (o *offerStore) remove(id string) {
+	o.mu.Lock()
+	delete(o.offers, id)
+	o.mu.Unlock()
+}
+
+// ServeHTTP serves GET /offers/{id} (the download) and
+// POST /offers/{id}/decline. Only the device an offer was made to may use it.
+func (o *offerStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, offersPath), "/")
+	client, _ := r.Context().Value(clientIDKey{}).(string)
+
+	o.mu.Lock()
+	offer, ok := o.offers[id]
+	o.mu.Unlock()
+	if !ok || offer.deviceID != client || time.Now().After(offer.expires) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "decline" && r.Method == http.MethodPost:
+		o.remove(id)
+		fmt.Printf("🙅 Offer declined: %s\n", offer.Name)
+		eventsFor(r).emit(OfferDeclined{ID: offer.ID, Name: offer.Name})
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+			fmt.Printf("📲 Offer accepted: %s\n", offer.Name)
+			eventsFor(r).emit(OfferAccepted{ID: offer.ID, Name: offer.Name})
+		}
+		sent := serveSent(o.transfers, offer.Name, offer.path, offer.digest, func(w http.ResponseWriter, r *http.Request) {
+			if offer.Folder {
+				serveArchive(w, r, offer.path)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(offer.path)))
+			http.ServeFile(w, r, offer.path)
+		}, w, r)
+		if sent {
+			o.remove(id)
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,78 @@
+package beamsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestOffer(t *testing.T, o *offerStore, id, deviceID string, expires time.Time) *fileOffer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	offer := &fileOffer{ID: id, Name: "photo.jpg", Size: 10, URL: offersPath + id, path: path,
+		deviceID: deviceID, digest: &fileDigest{path: path}, expires: expires}
+	o.offers[id] = offer
+	return offer
+}
+
+func offerRequest(id, client, rangeHeader string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, offersPath+id, nil)
+	if rangeHeader != "" {
+		r.Header.Set("Range", rangeHeader)
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientIDKey{}, client))
+}
+
+func TestOfferRemovedOnceDownloaded(t *testing.T) {
+	o := newOfferStore(nil, nil)
+	offer := newTestOffer(t, o, "abc", "phone", time.Now().Add(offerTTL))
+
+	// A first range leaves the offer open for the rest
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, offerRequest("abc", "phone", "bytes=0-3"))
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("first range: status %d", w.Code)
+	}
+	if _, ok := o.offers["abc"]; !ok {
+		t.Fatal("offer removed before the download finished")
+	}
+
+	w = httptest.NewRecorder()
+	o.ServeHTTP(w, offerRequest("abc", "phone", "bytes=4-"))
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("last range: status %d", w.Code)
+	}
+	if _, ok := o.offers["abc"]; ok {
+		t.Error("offer still open after a full download")
+	}
+	if !offer.digest.done.Load() {
+		t.Error("offer digest not computed")
+	}
+
+	w = httptest.NewRecorder()
+	o.ServeHTTP(w, offerRequest("abc", "phone", ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("download after completion: status %d, want 404", w.Code)
+	}
+}
+
+func TestOfferRefusedToOthersAndWhenExpired(t *testing.T) {
+	o := newOfferStore(nil, nil)
+	newTestOffer(t, o, "mine", "phone", time.Now().Add(offerTTL))
+	newTestOffer(t, o, "old", "phone", time.Now().Add(-time.Second))
+
+	for _, c := range []struct{ id, client string }{{"mine", "other-phone"}, {"old", "phone"}} {
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, offerRequest(c.id, c.client, ""))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("offer %s for %s: status %d, want 404", c.id, c.client, w.Code)
+		}
+	}
+}
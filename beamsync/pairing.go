@@ -0,0 +1,280 @@
+package beamsync
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairing restricts a receiver or sender to devices that proved they can
+// see the desktop: either by opening the QR URL, which carries a random
+// token, or by typing the PIN shown on screen. Both grant a session cookie.
+// A nil *Pairing leaves the servers open.
+//
+// One Pairing can guard several servers; cookies ignore ports, so a phone
+// paired with the receiver is also paired with the sender.
+type Pairing struct {
+	pin   string
+	token string
+
+	mu        sync.Mutex
+	sessions  map[string]time.Time
+	failures  map[string]*pinFailures
+	notified  map[string]time.Time
+	lastPrune time.Time
+}
+
+// pinFailures counts PIN attempts from one address since it last paired.
+type pinFailures struct {
+	count int
+	until time.Time // locked out before this
+	last  time.Time // latest attempt
+}
+
+const (
+	sessionCookie   = "beamsync_session"
+	pairingKeyParam = "key"
+	maxPINFailures  = 5
+	pinLockout      = time.Minute
+	// pairingMemory is how long attempts and notices are kept for a client
+	// that has gone quiet
+	pairingMemory = 10 * time.Minute
+)
+
+// NewPairing creates a pairing session with a fresh 6-digit PIN and token.
+func NewPairing() (*Pairing, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return &Pairing{
+		pin:      fmt.Sprintf("%06d", n.Int64()),
+		token:    token,
+		sessions: make(map[string]time.Time),
+		failures: make(map[string]*pinFailures),
+		notified: make(map[string]time.Time),
+	}, nil
+}
+
+// PIN is the code to show on the desktop for manual pairing.
+func (p *Pairing) PIN() string {
+	if p == nil {
+		return ""
+	}
+	return p.pin
+}
+
+// URL appends the pairing token to baseURL, for embedding in the QR code.
+func (p *Pairing) URL(baseURL string) string {
+	if p == nil {
+		return baseURL
+	}
+	return baseURL + "/?" + pairingKeyParam + "=" + url.QueryEscape(p.token)
+}
+
+// Protect wraps a server mux so only paired clients reach it.
+func (p *Pairing) Protect(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// QR code scans carry the token; trade it for a cookie
+		if key := r.URL.Query().Get(pairingKeyParam); key != "" {
+			if secureEqual(key, p.token) {
+				if p.grant(w, r) {
+					http.Redirect(w, r, "/", http.StatusSeeOther)
+				}
+				return
+			}
+		}
+
+		if r.URL.Path == "/pair" {
+			p.handlePIN(w, r)
+			return
+		}
+
+		if p.valid(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodGet && r.URL.Path == "/" {
+			p.notifyRequired(r)
+			servePairingPage(w, r.URL.Query().Has("error"))
+			return
+		}
+		http.Error(w, "Pairing required", http.StatusUnauthorized)
+	})
+}
+
+func (p *Pairing) handlePIN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Count the attempt before comparing, so guesses sent in parallel
+	// can't all slip in ahead of the lockout
+	ip := clientIP(r)
+	now := time.Now()
+	p.mu.Lock()
+	p.pruneLocked(now)
+	f := p.failures[ip]
+	if f == nil {
+		f = &pinFailures{}
+		p.failures[ip] = f
+	}
+	if now.Before(f.until) {
+		p.mu.Unlock()
+		http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	f.last = now
+	f.count++
+	if f.count >= maxPINFailures {
+		f.count = 0
+		f.until = now.Add(pinLockout)
+	}
+	p.mu.Unlock()
+
+	if !secureEqual(strings.TrimSpace(r.PostFormValue("pin")), p.pin) {
+		fmt.Printf("🚫 Wrong pairing PIN from %s\n", ip)
+		http.Redirect(w, r, "/?error=1", http.StatusSeeOther)
+		return
+	}
+
+	if p.grant(w, r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// grant starts a session for the requesting client. On failure the
+// error response has already been written.
+func (p *Pairing) grant(w http.ResponseWriter, r *http.Request) bool {
+	id, err := randomHex(32)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+
+	ip := clientIP(r)
+	p.mu.Lock()
+	p.sessions[id] = time.Now()
+	delete(p.failures, ip)
+	delete(p.notified, ip)
+	p.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	fmt.Printf("🤝 Device paired: %s\n", ip)
+	eventsFor(r).emit(Paired{IP: ip})
+	return true
+}
+
+func (p *Pairing) valid(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.sessions[cookie.Value]
+	return ok
+}
+
+// notifyRequired tells the desktop, once per client, that a device is
+// waiting for the PIN.
+func (p *Pairing) notifyRequired(r *http.Request) {
+	ip := clientIP(r)
+	now := time.Now()
+	p.mu.Lock()
+	p.pruneLocked(now)
+	_, seen := p.notified[ip]
+	first := !seen
+	p.notified[ip] = now
+	p.mu.Unlock()
+
+	if first {
+		fmt.Printf("🔐 Pairing required for %s\n", ip)
+		eventsFor(r).emit(PairingRequired{IP: ip})
+	}
+}
+
+// pruneLocked forgets, at most once a minute, clients that haven't tried a
+// PIN or loaded the pairing page for pairingMemory and aren't locked out;
+// the caller holds mu.
+func (p *Pairing) pruneLocked(now time.Time) {
+	if now.Sub(p.lastPrune) < time.Minute {
+		return
+	}
+	p.lastPrune = now
+	for ip, f := range p.failures {
+		if now.Sub(f.last) > pairingMemory && now.After(f.until) {
+			delete(p.failures, ip)
+		}
+	}
+	for ip, seen := range p.notified {
+		if now.Sub(seen) > pairingMemory {
+			delete(p.notified, ip)
+		}
+	}
+}
+
+func servePairingPage(w http.ResponseWriter, failed bool) {
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Header().Set("Content-Type", "text/html")
+
+	content, err := uiFS.ReadFile("ui/pair.html")
+	if err != nil {
+		http.Error(w, "UI Load Error", http.StatusInternalServerError)
+		return
+	}
+
+	message := ">> ENTER THE PIN SHOWN ON THE DESKTOP"
+	if failed {
+		message = ">> ERROR: INVALID PIN"
+	}
+	page := strings.Replace(string(content), "{{MESSAGE}}", message, 1)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(page))
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,89 @@
+package beamsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPINLockoutParallel sends many wrong PINs at once from one address;
+// only maxPINFailures of them may be compared.
+func TestPINLockoutParallel(t *testing.T) {
+	p, err := NewPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if p.PIN() == wrong {
+		wrong = "111111"
+	}
+	handler := p.Protect(http.NotFoundHandler())
+
+	const guesses = 40
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			form := url.Values{"pin": {wrong}}
+			r := httptest.NewRequest(http.MethodPost, "/pair", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	compared := 0
+	for code := range codes {
+		switch code {
+		case http.StatusSeeOther:
+			compared++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if compared != maxPINFailures {
+		t.Errorf("%d guesses were compared, want %d", compared, maxPINFailures)
+	}
+}
+
+func TestPairingPrunesQuietClients(t *testing.T) {
+	p, err := NewPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	old := now.Add(-pairingMemory - time.Second)
+	p.failures["192.0.2.1"] = &pinFailures{count: 2, last: old}
+	p.failures["192.0.2.2"] = &pinFailures{count: 1, last: now}
+	p.failures["192.0.2.3"] = &pinFailures{last: old, until: now.Add(time.Minute)}
+	p.notified["192.0.2.1"] = old
+	p.notified["192.0.2.2"] = now
+
+	p.pruneLocked(now)
+
+	if _, ok := p.failures["192.0.2.1"]; ok {
+		t.Error("quiet client's failures kept")
+	}
+	if _, ok := p.failures["192.0.2.2"]; !ok {
+		t.Error("recent failures dropped")
+	}
+	if _, ok := p.failures["192.0.2.3"]; !ok {
+		t.Error("lockout dropped before it ended")
+	}
+	if _, ok := p.notified["192.0.2.1"]; ok {
+		t.Error("quiet client's notice kept")
+	}
+	if _, ok := p.notified["192.0.2.2"]; !ok {
+		t.Error("recent notice dropped")
+	}
+}
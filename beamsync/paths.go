@@ -0,0 +1,96 @@
+package beamsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// errUnsafePath rejects upload paths that would land outside uploadDir.
+var errUnsafePath = errors.New("unsafe upload path")
+
+// cleanRelativePath turns a client-supplied name such as "photos/2024/a.jpg"
+// (from a folder upload) into a clean slash-separated relative path.
+// Absolute paths, drive letters and ".." segments are rejected outright
+// rather than silently flattened. An empty result means no usable name.
+func cleanRelativePath(raw string) (string, error) {
+	p := strings.ReplaceAll(raw, "\\", "/")
+	if strings.ContainsRune(p, 0) {
+		return "", errUnsafePath
+	}
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", errUnsafePath
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", errUnsafePath
+		}
+	}
+
+	p = path.Clean(p)
+	if p == "." {
+		return "", nil
+	}
+	if first, _, _ := strings.Cut(p, "/"); first == tusStateDir {
+		return "", errUnsafePath
+	}
+	return p, nil
+}
+
+// uploadName cleans a client path and falls back to a generated name.
+func uploadName(raw, fallback string) (string, error) {
+	rel, err := cleanRelativePath(raw)
+	if err != nil {
+		return "", err
+	}
+	if rel == "" {
+		return fallback, nil
+	}
+	return rel, nil
+}
+
+// prepareUploadTarget creates the subdirectories of rel under uploadDir and
+// returns the directory the file goes into plus its base name. Every level
+// is checked after creation so a symlink can't redirect it outside the root.
+func prepareUploadTarget(uploadDir, rel string) (string, string, error) {
+	relDir, name := path.Split(rel)
+	if relDir == "" {
+		return uploadDir, name, nil
+	}
+
+	realRoot, err := filepath.EvalSymlinks(uploadDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	dir := uploadDir
+	for _, segment := range strings.Split(strings.TrimSuffix(relDir, "/"), "/") {
+		dir = filepath.Join(dir, segment)
+		if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+			return "", "", err
+		}
+
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return "", "", err
+		}
+		if !insideRoot(realRoot, realDir) {
+			return "", "", fmt.Errorf("%w: %s escapes upload directory", errUnsafePath, rel)
+		}
+		if stat, err := os.Stat(realDir); err != nil || !stat.IsDir() {
+			return "", "", fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	return dir, name, nil
+}
+
+func insideRoot(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,11 +1,37 @@
 package beamsync
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 )
 
+var (
+	// ErrPermissionDenied means the system refused to let us bind a port,
+	// typically a firewall or privileged-port restriction.
+	ErrPermissionDenied = errors.New("permission denied binding port")
+	// ErrNoFreePort means every port tried was already in use.
+	ErrNoFreePort = errors.New("no free port")
+)
+
+// PortStep is how far apart the ports a server tries are. Receivers and
+// senders start on an even and an odd port, so they never compete for one.
+const PortStep = 2
+
+// PortsCollide reports whether servers scanning first1-last1 and
+// first2-last2 by PortStep could try the same port.
+func PortsCollide(first1, last1, first2, last2 int) bool {
+	lo, hi := max(first1, first2), min(last1, last2)
+	if lo > hi || (first1-first2)%PortStep != 0 {
+		return false
+	}
+	// The first port both scans reach at or after lo
+	port := lo + ((first1-lo)%PortStep+PortStep)%PortStep
+	return port <= hi
+}
+
 // FindAvailablePort tries to find a free port starting from startPort.
 // It iterates by 'step' (e.g. 2 for even/odd only) up to maxAttempts.
 // It returns the allocated port, the active listener, and any error.
@@ -21,12 +47,22 @@ func FindAvailablePort(startPort int, step int, maxAttempts int) (int, net.Liste
 
 		// If it's a permission error, don't keep trying, it's likely a system restriction
 		// typically "bind: permission denied" or "listen tcp :3000: bind: permission denied"
-		msg := err.Error()
-		if len(msg) > 0 && (strings.Contains(msg, "permission denied") || strings.Contains(msg, "access denied")) {
-			return 0, nil, err
+		if isPermissionError(err) {
+			return 0, nil, fmt.Errorf("%w: %w", ErrPermissionDenied, err)
 		}
 
 		fmt.Printf("⚠️ Port %d is busy/unavailable (%v), trying next...\n", port, err)
 	}
-	return 0, nil, fmt.Errorf("no available ports found after %d attempts", maxAttempts)
+	return 0, nil, fmt.Errorf("%w: tried %d ports from %d", ErrNoFreePort, maxAttempts, startPort)
+}
+
+// isPermissionError also matches Windows' WSAEACCES, which os.ErrPermission
+// doesn't cover.
+func isPermissionError(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "permission denied") || strings.Contains(msg, "access denied") ||
+		strings.Contains(msg, "access permissions")
 }
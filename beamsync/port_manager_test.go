@@ -0,0 +1,49 @@
+package beamsync
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortsCollide(t *testing.T) {
+	for _, c := range []struct {
+		name                         string
+		first1, last1, first2, last2 int
+		want                         bool
+	}{
+		{"default ranges interleave", DefaultReceiverPort, DefaultReceiverPort + 98, DefaultSenderPort, DefaultSenderPort + 98, false},
+		{"same parity overlapping", 3000, 3098, 3050, 3150, true},
+		{"same parity disjoint", 3000, 3010, 3012, 3020, false},
+		{"touching on a shared port", 3000, 3010, 3010, 3020, true},
+		{"single ports", 4000, 4000, 4000, 4000, true},
+		{"overlap holds no port of the scans", 3000, 3002, 3001, 3001, false},
+	} {
+		if got := PortsCollide(c.first1, c.last1, c.first2, c.last2); got != c.want {
+			t.Errorf("%s: PortsCollide(%d, %d, %d, %d) = %v, want %v",
+				c.name, c.first1, c.last1, c.first2, c.last2, got, c.want)
+		}
+		if got := PortsCollide(c.first2, c.last2, c.first1, c.last1); got != c.want {
+			t.Errorf("%s: swapped ranges give %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestFindAvailablePortSteps checks a busy port is skipped by PortStep, so
+// the scan keeps to its parity.
+func TestFindAvailablePortSteps(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	start := busy.Addr().(*net.TCPAddr).Port
+
+	port, listener, err := FindAvailablePort(start, PortStep, 2)
+	if err != nil {
+		t.Skipf("port %d also busy: %v", start+PortStep, err)
+	}
+	defer listener.Close()
+	if port != start+PortStep {
+		t.Errorf("got port %d after busy %d, want %d", port, start, start+PortStep)
+	}
+}
@@ -0,0 +1,65 @@
+package beamsync
+
+import (
+	"io"
+	"time"
+)
+
+// progressInterval throttles TransferProgress events per file.
+const progressInterval = 250 * time.Millisecond
+
+// progressReader counts bytes as they are copied and emits throttled
+// TransferProgress events.
+type progressReader struct {
+	events   *emitter
+	src      io.Reader
+	filename string
+	total    int64
+	written  int64
+
+	lastEmit  time.Time
+	lastBytes int64
+}
+
+// newProgressReader starts counting at offset, so resumed uploads report
+// their position in the whole file rather than in the current request.
+func newProgressReader(events *emitter, src io.Reader, filename string, offset, total int64) *progressReader {
+	return &progressReader{
+		events:    events,
+		src:       src,
+		filename:  filename,
+		total:     total,
+		written:   offset,
+		lastEmit:  time.Now(),
+		lastBytes: offset,
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.src.Read(b)
+	p.written += int64(n)
+
+	if time.Since(p.lastEmit) >= progressInterval {
+		p.emit()
+	}
+	return n, err
+}
+
+// Finish emits a final event so the desktop sees the exact byte count.
+func (p *progressReader) Finish() {
+	p.emit()
+}
+
+func (p *progressReader) emit() {
+	now := time.Now()
+	elapsed := now.Sub(p.lastEmit).Seconds()
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.written-p.lastBytes) / elapsed
+	}
+	p.lastEmit = now
+	p.lastBytes = p.written
+
+	p.events.emit(TransferProgress{Name: p.filename, Written: p.written, Total: p.total, BytesPerSec: rate})
+}
@@ -3,134 +3,370 @@ package beamsync
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type EventCallback func(eventName string, data string)
-
-var sendEvent EventCallback
+//go:embed ui/*.html
+var uiFS embed.FS
 
-var (
-	lastHeartbeat time.Time
-	isConnected   bool = false
-	stateMutex    sync.Mutex
+// ErrUploadDir means the receiver's upload directory can't be created or
+// written to.
+var ErrUploadDir = errors.New("upload directory unavailable")
+
+const (
+	// DefaultReceiverPort is where receivers start looking; they take even ports
+	DefaultReceiverPort = 3000
+	// DefaultSenderPort is where senders start looking; they take odd ports
+	DefaultSenderPort = 3005
+	// defaultPortAttempts is how many ports are tried without a MaxPort
+	defaultPortAttempts = 50
 )
 
-//go:embed ui/*.html
-var uiFS embed.FS
+// ReceiverOptions configures NewReceiver.
+type ReceiverOptions struct {
+	// ID tags the server's events; empty picks one like "receiver-1".
+	ID string
+	// UploadDir is created if it doesn't exist.
+	UploadDir string
+	// Port is the first port to try; 0 means DefaultReceiverPort.
+	Port int
+	// MaxPort is the last port to try; 0 allows 50 tries.
+	MaxPort int
+	// Collision decides what happens when a received name already
+	// exists; the zero value renames.
+	Collision CollisionPolicy
+	// Pairing, when set, restricts the server to paired devices.
+	Pairing *Pairing
+	// Identity, when set, serves HTTPS.
+	Identity *TLSIdentity
+	// Approvals, when set, hold every transfer until the desktop accepts it.
+	Approvals *Approvals
+}
 
-func SetEventCallback(callback EventCallback) {
-	sendEvent = callback
-	fmt.Println("🔧 Event callback registered")
+// SenderOptions configures NewSender.
+type SenderOptions struct {
+	// ID tags the server's events; empty picks one like "sender-2".
+	ID string
+	// Paths are the files and folders to share.
+	Paths []string
+	// Port is the first port to try; 0 means DefaultSenderPort.
+	Port int
+	// MaxPort is the last port to try; 0 allows 50 tries.
+	MaxPort  int
+	Pairing  *Pairing
+	Identity *TLSIdentity
 }
 
-// safeEmit is now package-level to be shared between Receiver and Sender
-func safeEmit(event, data string) {
-	go func(evt, dt string) {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("⚠️ Event callback panic: %v\n", r)
-			}
-		}()
+// HTTPServer is a receiver or sender; Start it, then Shutdown or Close
+// when done. Each server keeps its own devices, transfers and events, so
+// several can run in one process.
+type HTTPServer struct {
+	id        string
+	role      string
+	startPort int
+	attempts  int
+	identity  *TLSIdentity
+	approvals *Approvals
+	routes    func() (http.Handler, error)
+
+	server    *http.Server
+	port      int
+	cancel    context.CancelFunc
+	devices   *deviceTracker
+	offers    *offerStore
+	transfers *transferTracker
+	events    *emitter
+	mdns      *mdnsResponder
+
+	stopMu  sync.Mutex
+	stopped bool
+}
 
-		fmt.Printf("📡 Emitting event: %s | data: %s\n", evt, dt)
+// NewReceiver prepares a server that accepts uploads into opts.UploadDir.
+func NewReceiver(opts ReceiverOptions) *HTTPServer {
+	if opts.Port == 0 {
+		opts.Port = DefaultReceiverPort
+	}
+	if opts.Collision == "" {
+		opts.Collision = CollisionRename
+	}
+	s := &HTTPServer{
+		id:        instanceID(opts.ID, "receiver"),
+		role:      "receiver",
+		startPort: opts.Port,
+		attempts:  portAttempts(opts.Port, opts.MaxPort),
+		identity:  opts.Identity,
+		approvals: opts.Approvals,
+		transfers: newTransferTracker(),
+	}
+	s.events = newEmitter(s.id)
+	s.devices = newDeviceTracker("receiver", s.events)
+	s.offers = newOfferStore(s.devices, s.transfers)
+	s.routes = func() (http.Handler, error) { return s.receiverRoutes(opts) }
+	return s
+}
 
-		if sendEvent != nil {
-			sendEvent(evt, dt)
-			fmt.Printf("✅ Event emitted successfully: %s\n", evt)
-		}
-	}(event, data)
+// NewSender prepares a server that shares opts.Paths for download.
+func NewSender(opts SenderOptions) *HTTPServer {
+	if opts.Port == 0 {
+		opts.Port = DefaultSenderPort
+	}
+	s := &HTTPServer{
+		id:        instanceID(opts.ID, "sender"),
+		role:      "sender",
+		startPort: opts.Port,
+		attempts:  portAttempts(opts.Port, opts.MaxPort),
+		identity:  opts.Identity,
+		transfers: newTransferTracker(),
+	}
+	s.events = newEmitter(s.id)
+	s.devices = newDeviceTracker("sender", s.events)
+	s.routes = func() (http.Handler, error) { return s.senderRoutes(opts) }
+	return s
 }
 
-// HTTPServer wraps http.Server so we can shut it down
-type HTTPServer struct {
-	server *http.Server
-	cancel context.CancelFunc
+// portAttempts counts the ports from first to last, taking every other one.
+func portAttempts(first, last int) int {
+	if last == 0 {
+		return defaultPortAttempts
+	}
+	if last < first {
+		return 1
+	}
+	return (last-first)/PortStep + 1
 }
 
-func (s *HTTPServer) Shutdown() error {
-	if s.cancel != nil {
-		s.cancel()
+// instances numbers the servers created in this process.
+var instances atomic.Int64
+
+func instanceID(id, role string) string {
+	if id != "" {
+		return id
 	}
-	if s.server != nil {
-		return s.server.Close()
+	return fmt.Sprintf("%s-%d", role, instances.Add(1))
+}
+
+// ID is the instance ID that tags this server's events.
+func (s *HTTPServer) ID() string {
+	if s == nil {
+		return ""
 	}
-	return nil
+	return s.id
 }
 
-// StartServer using standard net/http (GTK-compatible)
-func StartServer(uploadDir string, startPort int) (*HTTPServer, string) {
-	fmt.Println("🚀 StartServer() called")
+// Subscribe calls fn for this server's events only; see the package-level
+// Subscribe.
+func (s *HTTPServer) Subscribe(fn func(instance string, e Event), opts SubscribeOptions) *Subscription {
+	return s.events.bus.subscribe(fn, opts)
+}
+
+// Port is the port the server listens on once started.
+func (s *HTTPServer) Port() int {
+	if s == nil {
+		return 0
+	}
+	return s.port
+}
+
+// AdvertisedName is the instance name the server announces over mDNS,
+// which DiscoverPeers reports as Peer.ID; "" when it isn't advertising.
+func (s *HTTPServer) AdvertisedName() string {
+	if s == nil || s.mdns == nil {
+		return ""
+	}
+	return s.mdns.instance
+}
+
+// Devices lists the devices currently connected to this server.
+func (s *HTTPServer) Devices() []Device {
+	if s == nil || s.devices == nil {
+		return nil
+	}
+	return s.devices.List()
+}
+
+// ActiveTransfers lists the uploads and downloads in progress.
+func (s *HTTPServer) ActiveTransfers() []Transfer {
+	if s == nil {
+		return nil
+	}
+	return s.transfers.List()
+}
+
+// Start binds a port and serves in the background until ctx is cancelled
+// or Shutdown is called; a cancelled ctx stops it like Close. Errors match
+// ErrUploadDir, ErrPermissionDenied or ErrNoFreePort where they apply.
+func (s *HTTPServer) Start(ctx context.Context) (err error) {
+	if s.server != nil {
+		return errors.New("server already started")
+	}
+	fmt.Printf("🚀 Starting %s...\n", s.role)
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("🚨 PANIC IN StartServer: %v\n", r)
+			fmt.Printf("🚨 PANIC starting %s: %v\n", s.role, r)
 			fmt.Printf("Stack trace:\n%s\n", debug.Stack())
+			err = fmt.Errorf("starting %s: %v", s.role, r)
 		}
 	}()
 
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			fmt.Println("❌ Failed to create upload directory:", err)
-			return nil, ""
-		}
+	handler, err := s.routes()
+	if err != nil {
+		return err
 	}
-	fmt.Printf("📁 Upload directory: %s\n", uploadDir)
 
-	fmt.Printf("📁 Upload directory: %s\n", uploadDir)
+	port, listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.port = port
+
+	s.server = &http.Server{
+		Handler: handler,
+		// Handlers find the server's event sink on the request context
+		BaseContext: func(net.Listener) context.Context {
+			return withEmitter(context.Background(), s.events)
+		},
+	}
+	// Event streams and approval prompts never finish on their own; end
+	// them so a graceful shutdown only waits for real transfers
+	s.server.RegisterOnShutdown(func() {
+		s.devices.closeStreams()
+		s.approvals.Close()
+	})
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Advertise on the LAN; the QR code still works if multicast is blocked
+	if s.mdns, err = startMDNS(nil, s.role, port, s.identity); err != nil {
+		fmt.Println("⚠️ mDNS advertisement unavailable:", err)
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.devices.Watch(ctx)
+	context.AfterFunc(ctx, func() { s.Close() })
 
-	// Watchdog
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				fmt.Printf("⚠️ Watchdog panic: %v\n", r)
+				fmt.Printf("❌ Server panic: %v\n", r)
 			}
 		}()
 
-		fmt.Println("👁️ Watchdog started")
-
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				fmt.Println("🛑 Watchdog stopped")
-				return
-			case <-ticker.C:
-				stateMutex.Lock()
-				connected := isConnected
-				last := lastHeartbeat
-				stateMutex.Unlock()
-
-				if connected && time.Since(last) > 15*time.Second {
-					stateMutex.Lock()
-					if isConnected {
-						isConnected = false
-						stateMutex.Unlock()
-						safeEmit("device_disconnected", "")
-						fmt.Println("💔 Device Disconnected (Timeout)")
-					} else {
-						stateMutex.Unlock()
-					}
-				}
-			}
+		fmt.Printf("🚀 Serving %s (%s) on :%d...\n", s.role, s.identity.Scheme(), port)
+		// Use Serve instead of ListenAndServe since we already have a listener
+		if err := s.server.Serve(s.identity.Listen(listener)); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("❌ Server error: %v\n", err)
 		}
 	}()
 
+	fmt.Printf("✅ %s started\n", strings.ToUpper(s.role[:1])+s.role[1:])
+	return nil
+}
+
+// listen finds a free port, receivers on even ports and senders on odd,
+// running the firewall setup once if binding is refused.
+func (s *HTTPServer) listen() (int, net.Listener, error) {
+	port, listener, err := FindAvailablePort(s.startPort, PortStep, s.attempts)
+	if err == nil {
+		return port, listener, nil
+	}
+	fmt.Printf("❌ Failed to find available port for %s: %v\n", s.role, err)
+	if !errors.Is(err, ErrPermissionDenied) {
+		return 0, nil, err
+	}
+
+	fmt.Println("🔒 Permission error detected. Attempting to run firewall setup...")
+	if fwErr := RunFirewallSetup(); fwErr != nil {
+		fmt.Printf("❌ Firewall setup failed: %v\n", fwErr)
+		return 0, nil, err
+	}
+	fmt.Println("✅ Firewall setup completed. Retrying port binding...")
+	port, listener, err = FindAvailablePort(s.startPort, PortStep, s.attempts)
+	if err != nil {
+		fmt.Println("❌ Still failed to find port after firewall setup:", err)
+	}
+	return port, listener, err
+}
+
+// Shutdown stops accepting connections and waits for in-flight transfers
+// to finish until ctx is done. Transfers still running then are cut off
+// and returned, and each is announced with a TransferAborted event.
+// The error only reports a failure to close. It is safe to call more than
+// once; later calls return immediately.
+func (s *HTTPServer) Shutdown(ctx context.Context) ([]Transfer, error) {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	if s.stopped {
+		return nil, nil
+	}
+	s.stopped = true
+
+	s.mdns.Close()
+	if s.server == nil {
+		return nil, nil
+	}
+	defer s.cancel()
+
+	if active := s.transfers.List(); len(active) > 0 {
+		fmt.Printf("⏳ Waiting for %d transfer(s) before stopping %s...\n", len(active), s.role)
+	}
+	if err := s.server.Shutdown(ctx); err == nil {
+		fmt.Printf("🛑 %s stopped\n", strings.ToUpper(s.role[:1])+s.role[1:])
+		return nil, nil
+	}
+
+	aborted := s.transfers.abort()
+	err := s.server.Close()
+	for _, t := range aborted {
+		fmt.Printf("✂️ Aborted %s of %s (%s)\n", t.Direction, t.Name, t.Device)
+		s.events.emit(TransferAborted{t})
+	}
+	return aborted, err
+}
+
+// Close stops the server at once, cutting off any transfers in flight.
+func (s *HTTPServer) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Shutdown(ctx)
+	return err
+}
+
+// receiverRoutes prepares the upload directory and the receiver's
+// handlers (GTK-compatible, standard net/http).
+func (s *HTTPServer) receiverRoutes(opts ReceiverOptions) (http.Handler, error) {
+	uploadDir := opts.UploadDir
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		fmt.Println("❌ Failed to create upload directory:", err)
+		return nil, fmt.Errorf("%w: %w", ErrUploadDir, err)
+	}
+	fmt.Printf("📁 Upload directory: %s\n", uploadDir)
+
+	policy := opts.Collision
+	if !policy.Valid() {
+		policy = CollisionRename
+	}
+	fmt.Printf("📑 Collision policy: %s\n", policy)
+
+	devices := s.devices
+	approvals := opts.Approvals
 	mux := http.NewServeMux()
 
-	// Heartbeat endpoint
+	// Event stream the page holds open; heartbeat is the fallback
+	mux.HandleFunc("/events", devices.eventsHandler())
+
+	// Heartbeat endpoint; the device tracker records the visit
 	mux.HandleFunc("/heartbeat", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -138,18 +374,6 @@ func StartServer(uploadDir string, startPort int) (*HTTPServer, string) {
 		}
 
 		fmt.Println("💓 Heartbeat received")
-		stateMutex.Lock()
-		lastHeartbeat = time.Now()
-		wasConnected := isConnected
-		if !isConnected {
-			isConnected = true
-		}
-		stateMutex.Unlock()
-
-		if !wasConnected {
-			safeEmit("device_connected", "Android Device")
-			fmt.Println("💚 Device Connected!")
-		}
 		w.WriteHeader(http.StatusOK)
 	})
 
@@ -170,153 +394,59 @@ func StartServer(uploadDir string, startPort int) (*HTTPServer, string) {
 		w.Write(content)
 	})
 
-	// Upload handler
-	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("📤 POST /upload - Upload started")
-
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("❌ PANIC in upload handler: %v\n", r)
-				fmt.Printf("Stack trace:\n%s\n", debug.Stack())
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-		}()
-
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		// Update heartbeat
-		stateMutex.Lock()
-		lastHeartbeat = time.Now()
-		if !isConnected {
-			isConnected = true
-		}
-		stateMutex.Unlock()
-
-		// Parse multipart form with 20GB limit
-		err := r.ParseMultipartForm(20 * 1024 * 1024 * 1024)
-		if err != nil {
-			fmt.Println("❌ Failed to parse multipart form:", err)
-			http.Error(w, "Failed to parse form", http.StatusBadRequest)
-			return
-		}
-
-		fmt.Println("✅ Multipart form parsed successfully")
-
-		files := r.MultipartForm.File["documents"]
-		if len(files) == 0 {
-			http.Error(w, "No files uploaded", http.StatusBadRequest)
-			return
-		}
+	// Transfer requests wait here for the desktop to accept or decline
+	mux.HandleFunc("/request", approvals.requestHandler())
 
-		fmt.Printf("📦 Processing %d file(s)\n", len(files))
+	// Files pushed from the desktop to the connected page
+	mux.Handle(offersPath, s.offers)
 
-		for i, fileHeader := range files {
-			fmt.Printf("📄 Processing file #%d: %s\n", i+1, fileHeader.Filename)
-
-			file, err := fileHeader.Open()
-			if err != nil {
-				fmt.Println("❌ Failed to open file:", err)
-				continue
-			}
-
-			filename := filepath.Base(fileHeader.Filename)
-			if filename == "" || filename == "." {
-				filename = fmt.Sprintf("upload_%d.bin", time.Now().Unix())
-			}
-
-			dstPath := filepath.Join(uploadDir, filename)
-			fmt.Printf("💾 Saving to: %s\n", dstPath)
-
-			dst, err := os.Create(dstPath)
-			if err != nil {
-				fmt.Println("❌ File creation error:", err)
-				file.Close()
-				continue
-			}
-
-			written, err := io.Copy(dst, file)
-			dst.Close()
-			file.Close()
+	// Upload handler
+	mux.HandleFunc("/upload", uploadHandler(uploadDir, policy, approvals, s.transfers))
 
-			if err != nil {
-				fmt.Println("❌ Copy error:", err)
-				continue
-			}
+	// Resumable uploads (tus 1.0)
+	tus, err := newTusStore(uploadDir, policy, approvals, s.transfers)
+	if err != nil {
+		fmt.Println("❌ Failed to prepare resumable upload store:", err)
+		return nil, fmt.Errorf("%w: %w", ErrUploadDir, err)
+	}
+	mux.Handle(tusBasePath, tus)
 
-			fmt.Printf("✅ File saved: %s (%d bytes)\n", filename, written)
+	return s.identity.RedirectPlain(opts.Pairing.Protect(devices.Track(mux))), nil
+}
 
-			// Emit event asynchronously
-			go func(fname string) {
-				time.Sleep(100 * time.Millisecond)
-				safeEmit("file_received", fname)
-			}(filename)
-		}
+// senderRoutes serves opts.Paths with the event stream and heartbeat
+// fallback, like the receiver.
+func (s *HTTPServer) senderRoutes(opts SenderOptions) (http.Handler, error) {
+	filePaths := opts.Paths
+	if len(filePaths) == 0 {
+		return nil, errors.New("nothing to share")
+	}
 
-		fmt.Println("✅ Upload handler completed successfully")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("✅ Upload Complete"))
-		fmt.Println("🔄 Server still running, waiting for more requests...")
-	})
+	// The sender tracks its own devices; downloads don't keep the receiver alive
+	devices := s.devices
+	mux := http.NewServeMux()
 
-	// Find an available EVEN port for Receiver (3000, 3002, ...)
-	portInt, listener, err := FindAvailablePort(startPort, 2, 50)
-	if err != nil {
-		fmt.Println("❌ Failed to find available port for Receiver:", err)
-
-		// Attempt auto-fix for permissions
-		if strings.Contains(err.Error(), "permission") || strings.Contains(err.Error(), "access") {
-			fmt.Println("🔒 Permission error detected. Attempting to run firewall setup...")
-			if fwErr := RunFirewallSetup(); fwErr != nil {
-				fmt.Printf("❌ Firewall setup failed: %v\n", fwErr)
-			} else {
-				fmt.Println("✅ Firewall setup completed. Retrying port binding...")
-				portInt, listener, err = FindAvailablePort(startPort, 2, 50)
-				if err != nil {
-					fmt.Println("❌ Still failed to find port after firewall setup:", err)
-					cancel()
-					return nil, ""
-				}
-			}
-		} else {
-			cancel() // Fix context leak
-			return nil, ""
+	// Directories are served as streaming archives and browsable listings
+	isDir := make([]bool, len(filePaths))
+	for i, path := range filePaths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			isDir[i] = true
 		}
 	}
-	portStr := fmt.Sprintf("%d", portInt)
-
-	server := &http.Server{
-		Handler: mux,
-	}
-
-	httpServer := &HTTPServer{server: server, cancel: cancel}
 
+	// Hash shared files in the background so the manifest is ready early
+	digests := newFileDigests(filePaths)
 	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("❌ Server panic: %v\n", r)
+		for i, d := range digests {
+			if !isDir[i] {
+				d.SHA256()
 			}
-		}()
-
-		fmt.Printf("🚀 Starting HTTP server on :%s...\n", portStr)
-		// Use Serve instead of ListenAndServe since we already have a listener
-		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("❌ Server error: %v\n", err)
 		}
 	}()
 
-	fmt.Println("✅ StartServer() completed")
-	return httpServer, portStr
-}
+	// 1. Event stream and Heartbeat fallback (same as Receiver)
+	mux.HandleFunc("/events", devices.eventsHandler())
 
-// StartSender remains with Fiber (sender doesn't have the same issue)
-// StartSender with Heartbeat support
-func StartSender(filePaths []string) (*HTTPServer, string) {
-	mux := http.NewServeMux()
-
-	// 1. Heartbeat Handler (same as Receiver)
 	mux.HandleFunc("/heartbeat", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 		if r.Method != http.MethodPost {
@@ -325,33 +455,23 @@ func StartSender(filePaths []string) (*HTTPServer, string) {
 		}
 
 		fmt.Println("💓 Sender Heartbeat received")
-		stateMutex.Lock()
-		lastHeartbeat = time.Now()
-		wasConnected := isConnected
-		if !isConnected {
-			isConnected = true
-		}
-		stateMutex.Unlock()
-
-		if !wasConnected {
-			// Reuse the same event for simplicity, or add a specific one
-			safeEmit("device_connected", "Mobile (Downloader)")
-			fmt.Println("💚 Device Connected to Sender!")
-		}
 		w.WriteHeader(http.StatusOK)
 	})
 
 	// 2. Serve Files
-	if len(filePaths) == 1 {
+	if len(filePaths) == 1 && !isDir[0] {
 		filePath := filePaths[0]
 		filename := filepath.Base(filePath)
 
 		// Serve the actual file at a specific path
-		mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		mux.HandleFunc("/download", reportSent(s.transfers, filename, filePath, digests[0], func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+			setDigestHeaders(w, digests[0])
 			http.ServeFile(w, r, filePath)
-		})
+		}))
+
+		mux.HandleFunc("/manifest.json", manifestHandler(filePaths, isDir, digests, func(int) string { return "/download" }))
 
 		// Serve HTML page with Heartbeat script
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -365,91 +485,184 @@ func StartSender(filePaths []string) (*HTTPServer, string) {
 			}
 
 			// Simple Single File Template
-			html := string(content)
+			page := string(content)
 			fileBlock := fmt.Sprintf(`<div class="file-card">
 				<div class="file-info">%s</div>
 				<a href="/download" class="download-btn" onclick="startDownload()">⬇️ SAVE</a>
 			</div>
-			<script>function startDownload() { setTimeout(() => alert("Download Started"), 500); }</script>`, filename)
+			<script>function startDownload() { setTimeout(() => alert("Download Started"), 500); }</script>`, html.EscapeString(filename))
 
-			html = strings.Replace(html, "{{FILES}}", fileBlock, 1)
-			w.Write([]byte(html))
+			page = strings.Replace(page, "{{FILES}}", fileBlock, 1)
+			w.Write([]byte(page))
 		})
 	} else {
 		// Multi-file mode
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
-			w.Header().Set("Content-Type", "text/html")
-
-			content, err := uiFS.ReadFile("ui/download.html")
-			if err != nil {
-				http.Error(w, "UI Load Error", http.StatusInternalServerError)
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
 				return
 			}
 
 			// Generate File List
 			var builder strings.Builder
+			builder.WriteString(`<div class="file-card">
+					<div class="file-info">📦 ALL FILES</div>
+					<a href="/download/all" class="download-btn">⬇️ ZIP</a>
+				</div>`)
 			for i, path := range filePaths {
+				if isDir[i] {
+					builder.WriteString(directoryCard(i, path))
+					continue
+				}
 				fname := filepath.Base(path)
 				builder.WriteString(fmt.Sprintf(`<div class="file-card">
 					<div class="file-info">%s</div>
 					<a href="/download/%d" class="download-btn">⬇️ SAVE</a>
-				</div>`, fname, i))
+				</div>`, html.EscapeString(fname), i))
 			}
 
-			html := string(content)
-			html = strings.Replace(html, "{{FILES}}", builder.String(), 1)
-			w.Write([]byte(html))
+			renderDownloadPage(w, builder.String())
 		})
 
+		mux.HandleFunc("/browse/", browseHandler(filePaths, isDir, s.transfers))
+		mux.HandleFunc("/download/all", reportSent(s.transfers, "BeamSync.zip", "", nil, downloadAllHandler(filePaths, isDir)))
+
 		for i, path := range filePaths {
 			idx := i
 			filePath := path
-			mux.HandleFunc(fmt.Sprintf("/download/%d", idx), func(w http.ResponseWriter, r *http.Request) {
+			var digest *fileDigest
+			if !isDir[idx] {
+				digest = digests[idx]
+			}
+			mux.HandleFunc(fmt.Sprintf("/download/%d", idx), reportSent(s.transfers, filepath.Base(filePath), filePath, digest, func(w http.ResponseWriter, r *http.Request) {
+				if isDir[idx] {
+					serveArchive(w, r, filePath)
+					return
+				}
 				w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(filePath)))
+				setDigestHeaders(w, digests[idx])
 				http.ServeFile(w, r, filePath)
-			})
+			}))
 		}
+
+		mux.HandleFunc("/manifest.json", manifestHandler(filePaths, isDir, digests, func(i int) string { return fmt.Sprintf("/download/%d", i) }))
+	}
+
+	return s.identity.RedirectPlain(opts.Pairing.Protect(devices.Track(mux))), nil
+}
+
+// reportSent tracks a download of name, served from path, and emits
+// file_sent once a client has the whole of it, whether in one response or
+// by finishing a ranged resume, or file_failed if the client went away
+// part way. digest is nil for archives.
+func reportSent(transfers *transferTracker, name, path string, digest *fileDigest, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveSent(transfers, name, path, digest, next, w, r)
 	}
+}
 
-	// Find an available ODD port for Sender (3005, 3007, ...)
-	portInt, listener, err := FindAvailablePort(3005, 2, 50)
+// serveSent is reportSent for one request; it reports whether the client
+// now has the whole file.
+func serveSent(transfers *transferTracker, name, path string, digest *fileDigest, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		next(w, r)
+		return false
+	}
+	started := time.Now()
+	transfer := transfers.begin(r, "download", name)
+	defer transfer.end()
+	rec := &sentRecorder{ResponseWriter: w}
+	next(rec, r)
+
+	if rec.status != http.StatusOK && rec.status != http.StatusPartialContent {
+		return false
+	}
+	err := rec.err
+	if err == nil {
+		err = r.Context().Err()
+	}
 	if err != nil {
-		fmt.Println("❌ Failed to find available port for Sender:", err)
-
-		// Attempt auto-fix for permissions
-		if strings.Contains(err.Error(), "permission") || strings.Contains(err.Error(), "access") {
-			fmt.Println("🔒 Permission error detected. Attempting to run firewall setup...")
-			if fwErr := RunFirewallSetup(); fwErr != nil {
-				fmt.Printf("❌ Firewall setup failed: %v\n", fwErr)
-			} else {
-				fmt.Println("✅ Firewall setup completed. Retrying port binding...")
-				portInt, listener, err = FindAvailablePort(3005, 2, 50)
-				if err != nil {
-					fmt.Println("❌ Still failed to find port after firewall setup:", err)
-					return nil, ""
-				}
-			}
-		} else {
-			return nil, ""
+		if transfer.aborted() {
+			return false
 		}
+		fmt.Printf("⚠️ Download of %s cut off after %d bytes: %v\n", name, rec.written, err)
+		eventsFor(r).emit(TransferFailed{Name: name, Direction: "download", Reason: err.Error(),
+			Device: deviceName(r), StartedAt: started})
+		return false
 	}
-	portStr := fmt.Sprintf("%d", portInt)
 
-	server := &http.Server{
-		Handler: mux,
+	complete := rec.status == http.StatusOK
+	if rec.status == http.StatusPartialContent {
+		complete = rangeReachesEnd(w.Header().Get("Content-Range"))
+	}
+	if !complete {
+		return false
 	}
 
-	httpServer := &HTTPServer{server: server}
-
-	go func() {
-		fmt.Printf("🚀 Starting sender on :%s...\n", portStr)
-		// Use Serve instead of ListenAndServe since we already have a listener
-		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
-			fmt.Println("❌ Sender error:", err)
+	fmt.Printf("📤 Download complete: %s\n", name)
+	sent := FileSent{Name: name, Path: path, Size: rec.written, Device: deviceName(r), StartedAt: started}
+	if digest != nil {
+		// Whole file, not just the last range of a resume
+		if info, err := os.Stat(digest.path); err == nil {
+			sent.Size = info.Size()
 		}
-	}()
+		sent.SHA256, _ = digest.SHA256()
+	}
+	eventsFor(r).emit(sent)
+	return true
+}
+
+// sentRecorder remembers the response status and body size for reportSent.
+type sentRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	err     error // first write that failed
+}
 
-	return httpServer, portStr
+func (s *sentRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *sentRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.written += int64(n)
+	if s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// ReadFrom keeps http.ServeFile on the sendfile fast path.
+func (s *sentRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := io.Copy(s.ResponseWriter, src)
+	s.written += n
+	if s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+func (s *sentRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// rangeReachesEnd reports whether a "bytes first-last/total" Content-Range
+// covers the final byte.
+func rangeReachesEnd(contentRange string) bool {
+	var first, last, total int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &total); err != nil {
+		return false
+	}
+	return last+1 == total
 }
@@ -0,0 +1,111 @@
+package beamsync
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The upload and download pages hold a Server-Sent Events stream open on
+// /events. It replaces heartbeat polling: the device stays connected while
+// the stream is up, a dropped stream is noticed straight away, and the
+// server can push messages to the phone. Browsers without EventSource fall
+// back to POSTing /heartbeat.
+
+// streamMessage is one server-sent event.
+type streamMessage struct {
+	Event string
+	Data  string
+}
+
+// streamKeepAlive is how often an idle stream gets a comment line, so dead
+// connections surface as write errors and proxies don't time them out.
+const streamKeepAlive = 15 * time.Second
+
+// eventsHandler serves GET /events for the devices tracked by t.
+func (t *deviceTracker) eventsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, _ := r.Context().Value(clientIDKey{}).(string)
+		if id == "" {
+			http.Error(w, "Unknown client", http.StatusBadRequest)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		ch := t.subscribe(id)
+		defer t.unsubscribe(id, ch)
+
+		// Tell the page reconnects should be quick and confirm the channel
+		fmt.Fprintf(w, "retry: %d\n\n", streamGrace.Milliseconds()/2)
+		if writeStreamMessage(w, streamMessage{Event: "hello", Data: id}) != nil || rc.Flush() != nil {
+			return
+		}
+		fmt.Printf("📶 Event stream opened (%s): %s\n", t.role, id)
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				fmt.Printf("📴 Event stream closed (%s): %s\n", t.role, id)
+				return
+			case <-t.closing:
+				writeStreamMessage(w, streamMessage{Event: "notice", Data: "BeamSync is shutting down on the computer"})
+				rc.Flush()
+				return
+			case msg := <-ch:
+				err = writeStreamMessage(w, msg)
+			case <-ticker.C:
+				_, err = fmt.Fprint(w, ": ping\n\n")
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				fmt.Printf("📴 Event stream lost (%s): %s\n", t.role, id)
+				return
+			}
+		}
+	}
+}
+
+func writeStreamMessage(w http.ResponseWriter, msg streamMessage) error {
+	var b strings.Builder
+	if msg.Event != "" {
+		b.WriteString("event: " + msg.Event + "\n")
+	}
+	for _, line := range strings.Split(msg.Data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
+
+// Notify pushes a notice to the pages of every connected device, or only
+// to deviceID when it is set. It returns how many devices received it.
+func (s *HTTPServer) Notify(deviceID, text string) int {
+	if s == nil || s.devices == nil {
+		return 0
+	}
+	msg := streamMessage{Event: "notice", Data: text}
+	if deviceID == "" {
+		return s.devices.Broadcast(msg)
+	}
+	if s.devices.Push(deviceID, msg) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,269 @@
+package beamsync
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSIdentity is the self-signed certificate the servers present in secure
+// mode. Phones can't chain it to a trusted root, so the SHA-256 fingerprint
+// is shown on the desktop (and carried in the QR code) for pinning instead.
+// A nil *TLSIdentity leaves the servers on plain HTTP.
+type TLSIdentity struct {
+	cert        tls.Certificate
+	fingerprint string
+}
+
+const (
+	certFile     = "cert.pem"
+	keyFile      = "key.pem"
+	certValidity = 10 * 365 * 24 * time.Hour
+	certRenewal  = 30 * 24 * time.Hour
+	sniffTimeout = 10 * time.Second
+)
+
+// LoadOrCreateIdentity loads the certificate persisted in dir, generating
+// a new one if it is missing, unreadable or about to expire. Keeping it
+// across runs means a fingerprint the user has already verified stays valid.
+func LoadOrCreateIdentity(dir string) (*TLSIdentity, error) {
+	certPath := filepath.Join(dir, certFile)
+	keyPath := filepath.Join(dir, keyFile)
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > certRenewal {
+			return newTLSIdentity(cert), nil
+		}
+	}
+
+	fmt.Println("🔏 Generating self-signed certificate...")
+	certPEM, keyPEM, err := generateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return newTLSIdentity(cert), nil
+}
+
+func newTLSIdentity(cert tls.Certificate) *TLSIdentity {
+	sum := sha256.Sum256(cert.Certificate[0])
+	return &TLSIdentity{cert: cert, fingerprint: hex.EncodeToString(sum[:])}
+}
+
+func generateCertificate() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "BeamSync " + hostname, Organization: []string{"BeamSync"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// Fingerprint is the lowercase hex SHA-256 of the certificate.
+func (id *TLSIdentity) Fingerprint() string {
+	if id == nil {
+		return ""
+	}
+	return id.fingerprint
+}
+
+// DisplayFingerprint groups the fingerprint as AB:CD:... for reading aloud.
+func (id *TLSIdentity) DisplayFingerprint() string {
+	fp := strings.ToUpper(id.Fingerprint())
+	var pairs []string
+	for i := 0; i+1 < len(fp); i += 2 {
+		pairs = append(pairs, fp[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// Scheme is "https" in secure mode and "http" otherwise.
+func (id *TLSIdentity) Scheme() string {
+	if id == nil {
+		return "http"
+	}
+	return "https"
+}
+
+// Listen wraps a listener so TLS handshakes are served over HTTPS while
+// plain HTTP on the same port still reaches the server, to be redirected.
+func (id *TLSIdentity) Listen(l net.Listener) net.Listener {
+	if id == nil {
+		return l
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{id.cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return newSniffListener(l, config)
+}
+
+// RedirectPlain sends plain HTTP requests to the HTTPS URL on the same port.
+// No HSTS header is set: browsers refuse to let users accept a self-signed
+// certificate on HSTS hosts.
+func (id *TLSIdentity) RedirectPlain(next http.Handler) http.Handler {
+	if id == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sniffListener peeks at the first byte of every connection: a TLS record
+// (0x16, handshake) becomes a *tls.Conn, which http.Server recognises and
+// serves as HTTPS; anything else is passed through as plain HTTP.
+type sniffListener struct {
+	net.Listener
+	config *tls.Config
+
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newSniffListener(l net.Listener, config *tls.Config) *sniffListener {
+	s := &sniffListener{
+		Listener: l,
+		config:   config,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go s.acceptLoop()
+	return s
+}
+
+func (s *sniffListener) acceptLoop() {
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			select {
+			case <-s.done:
+			default:
+				fmt.Printf("❌ Accept failed: %v\n", err)
+			}
+			s.Close()
+			return
+		}
+		// Sniff off the accept loop so one silent client can't stall the rest
+		go s.sniff(conn)
+	}
+}
+
+func (s *sniffListener) sniff(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	first, err := br.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	var c net.Conn = &peekedConn{Conn: conn, r: br}
+	if first[0] == 0x16 {
+		c = tls.Server(c, s.config)
+	}
+
+	select {
+	case s.conns <- c:
+	case <-s.done:
+		c.Close()
+	}
+}
+
+func (s *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.conns:
+		return c, nil
+	case <-s.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (s *sniffListener) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.Listener.Close()
+	})
+	return err
+}
+
+// peekedConn replays the bytes buffered while sniffing.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
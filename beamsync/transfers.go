@@ -0,0 +1,132 @@
+package beamsync
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Transfer is an upload or download in progress.
+type Transfer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Direction string    `json:"direction"` // "upload" to us or "download" from us
+	Device    string    `json:"device"`
+	StartedAt time.Time `json:"startedAt"`
+	// Resumable uploads pick up where they stopped if cut off
+	Resumable bool `json:"resumable"`
+}
+
+// transferTracker lists a server's in-flight transfers so shutdown can
+// wait for them and name the ones it had to cut off.
+type transferTracker struct {
+	mu       sync.Mutex
+	next     int
+	active   map[string]*Transfer
+	aborting bool
+}
+
+func newTransferTracker() *transferTracker {
+	return &transferTracker{active: make(map[string]*Transfer)}
+}
+
+// activeTransfer is the handle a handler holds while a transfer runs.
+type activeTransfer struct {
+	tracker *transferTracker
+	id      string
+}
+
+// begin registers a transfer for r; call end when the handler is done.
+// A nil tracker hands out handles that do nothing.
+func (t *transferTracker) begin(r *http.Request, direction, name string) *activeTransfer {
+	if t == nil {
+		return nil
+	}
+	tr := Transfer{
+		Name:      name,
+		Direction: direction,
+		Device:    deviceName(r),
+		StartedAt: time.Now(),
+	}
+	t.mu.Lock()
+	t.next++
+	tr.ID = fmt.Sprintf("t%d", t.next)
+	t.active[tr.ID] = &tr
+	t.mu.Unlock()
+
+	eventsFor(r).emit(TransferStarted{tr})
+	return &activeTransfer{tracker: t, id: tr.ID}
+}
+
+// rename updates the name as a multipart upload moves on to its next file.
+func (a *activeTransfer) rename(name string) {
+	if a == nil {
+		return
+	}
+	a.tracker.mu.Lock()
+	if tr, ok := a.tracker.active[a.id]; ok {
+		tr.Name = name
+	}
+	a.tracker.mu.Unlock()
+}
+
+// resumable marks a transfer the client can resume after an interruption.
+func (a *activeTransfer) resumable() {
+	if a == nil {
+		return
+	}
+	a.tracker.mu.Lock()
+	if tr, ok := a.tracker.active[a.id]; ok {
+		tr.Resumable = true
+	}
+	a.tracker.mu.Unlock()
+}
+
+func (a *activeTransfer) end() {
+	if a == nil {
+		return
+	}
+	a.tracker.mu.Lock()
+	delete(a.tracker.active, a.id)
+	a.tracker.mu.Unlock()
+}
+
+// abort returns the transfers in progress as a shutdown is about to cut
+// them off. Their handlers then leave reporting them to the shutdown.
+func (t *transferTracker) abort() []Transfer {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	t.aborting = true
+	t.mu.Unlock()
+	return t.List()
+}
+
+// aborted reports whether a shutdown cut this transfer off.
+func (a *activeTransfer) aborted() bool {
+	if a == nil {
+		return false
+	}
+	a.tracker.mu.Lock()
+	defer a.tracker.mu.Unlock()
+	return a.tracker.aborting
+}
+
+// List returns the transfers in progress, oldest first.
+func (t *transferTracker) List() []Transfer {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	out := make([]Transfer, 0, len(t.active))
+	for _, tr := range t.active {
+		out = append(out, *tr)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
@@ -0,0 +1,614 @@
+package beamsync
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resumable uploads following the tus 1.0 protocol (core, creation and
+// termination extensions). See https://tus.io/protocols/resumable-upload
+//
+// Partial uploads live in a hidden directory inside uploadDir so they
+// survive a receiver restart as long as the same folder is used again,
+// until they sit idle for tusIdleTTL.
+// The current offset of an upload is simply the size of its data file.
+
+const (
+	tusBasePath   = "/files/"
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusStateDir   = ".beamsync-tus"
+)
+
+// tusInfo is the sidecar metadata persisted next to each partial upload.
+type tusInfo struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	Completed bool              `json:"completed"`
+}
+
+// filename is the sanitised relative path announced in Upload-Metadata.
+// It was validated on creation, so errors only yield the fallback name.
+func (info tusInfo) filename() string {
+	fallback := fmt.Sprintf("upload_%s.bin", info.ID[:8])
+	filename, err := uploadName(info.Metadata["filename"], fallback)
+	if err != nil {
+		return fallback
+	}
+	return filename
+}
+
+// modTime is the client's lastModified metadata, if any.
+func (info tusInfo) modTime() time.Time {
+	return parseLastModified(info.Metadata["lastModified"])
+}
+
+// tusCompletedTTL is how long finished uploads still answer HEAD, so a
+// client that lost the final response doesn't send the file again.
+const tusCompletedTTL = 24 * time.Hour
+
+// tusIdleTTL is how long a partial upload may sit untouched before it is
+// given up and its data deleted.
+const tusIdleTTL = 48 * time.Hour
+
+// tusPruneInterval is how often a running receiver looks for uploads to
+// prune.
+const tusPruneInterval = time.Hour
+
+// tusStore serves the /files/ endpoint for a single upload directory.
+type tusStore struct {
+	uploadDir string
+	stateDir  string
+	policy    CollisionPolicy
+	approvals *Approvals
+	transfers *transferTracker
+
+	mu        sync.Mutex
+	locks     map[string]*tusLock
+	lastPrune time.Time
+}
+
+// tusLock is held by requests for one upload ID; it leaves the map once no
+// request holds or waits for it.
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newTusStore(uploadDir string, policy CollisionPolicy, approvals *Approvals, transfers *transferTracker) (*tusStore, error) {
+	stateDir := filepath.Join(uploadDir, tusStateDir)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+	t := &tusStore{
+		uploadDir: uploadDir,
+		stateDir:  stateDir,
+		policy:    policy,
+		approvals: approvals,
+		transfers: transfers,
+		locks:     make(map[string]*tusLock),
+	}
+	t.prune()
+	return t, nil
+}
+
+// prune drops bookkeeping for uploads that finished long ago, and gives
+// up on partial uploads idle for longer than tusIdleTTL.
+func (t *tusStore) prune() {
+	t.mu.Lock()
+	t.lastPrune = time.Now()
+	t.mu.Unlock()
+
+	entries, err := os.ReadDir(t.stateDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validTusID(id) {
+			continue
+		}
+		unlock := t.lock(id)
+		info, _, err := t.load(id)
+		if err == nil && info.Completed && time.Since(info.CreatedAt) > tusCompletedTTL {
+			t.discard(id)
+		} else if err == nil && !info.Completed && time.Since(t.lastActive(id)) > tusIdleTTL {
+			fmt.Printf("🧹 Dropping abandoned upload %s (%s)\n", id, info.filename())
+			t.discard(id)
+		}
+		unlock()
+	}
+}
+
+// pruneIfDue prunes when the last run was over tusPruneInterval ago.
+func (t *tusStore) pruneIfDue() {
+	t.mu.Lock()
+	due := time.Since(t.lastPrune) > tusPruneInterval
+	t.mu.Unlock()
+	if due {
+		t.prune()
+	}
+}
+
+// lastActive is when data for an upload last arrived, or when it was
+// created if none has.
+func (t *tusStore) lastActive(id string) time.Time {
+	if stat, err := os.Stat(t.dataPath(id)); err == nil {
+		return stat.ModTime()
+	}
+	if stat, err := os.Stat(t.infoPath(id)); err == nil {
+		return stat.ModTime()
+	}
+	return time.Time{}
+}
+
+// lock serialises requests touching the same upload ID.
+func (t *tusStore) lock(id string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[id]
+	if !ok {
+		l = &tusLock{}
+		t.locks[id] = l
+	}
+	l.refs++
+	t.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(t.locks, id)
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *tusStore) dataPath(id string) string {
+	return filepath.Join(t.stateDir, id+".bin")
+}
+
+func (t *tusStore) infoPath(id string) string {
+	return filepath.Join(t.stateDir, id+".json")
+}
+
+func (t *tusStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusBasePath)
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		t.create(w, r)
+		return
+	}
+
+	if !validTusID(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		t.head(w, r, id)
+	case http.MethodPatch:
+		t.patch(w, r, id)
+	case http.MethodDelete:
+		t.terminate(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// create implements the creation extension (POST /files/).
+func (t *tusStore) create(w http.ResponseWriter, r *http.Request) {
+	t.pruneIfDue()
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	if metadata["sha256"], err = normalizeSHA256(metadata["sha256"]); err != nil {
+		http.Error(w, "Invalid sha256", http.StatusBadRequest)
+		return
+	}
+	if metadata["sha256"] == "" {
+		delete(metadata, "sha256")
+	}
+	name, err := cleanRelativePath(metadata["filename"])
+	if err != nil {
+		fmt.Printf("🚫 Rejected upload path %q: %v\n", metadata["filename"], err)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	// Nothing is written until the desktop has let the file in
+	if name == "" {
+		name = "(unnamed)"
+	}
+	limit, ok := t.approvals.authorize(w, r, IncomingFile{Name: name, Size: length})
+	if !ok {
+		return
+	}
+	if limit >= 0 && length > limit {
+		fmt.Printf("🚫 Rejected %s: %d bytes but %d approved\n", name, length, limit)
+		http.Error(w, "Upload-Length exceeds the approved size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	id, err := newTusID()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	info := tusInfo{ID: id, Length: length, Metadata: metadata, CreatedAt: time.Now()}
+	if err := t.writeInfo(info); err != nil {
+		fmt.Println("❌ Failed to persist upload info:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Create(t.dataPath(id))
+	if err != nil {
+		fmt.Println("❌ Failed to create upload data file:", err)
+		os.Remove(t.infoPath(id))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+
+	fmt.Printf("🆕 Resumable upload created: %s (%s, %d bytes)\n", id, metadata["filename"], length)
+
+	// Empty files are complete as soon as they exist
+	if length == 0 {
+		if !t.complete(w, r, info) {
+			return
+		}
+	}
+
+	w.Header().Set("Location", tusBasePath+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head reports the current offset so clients know where to resume.
+func (t *tusStore) head(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := t.lock(id)
+	defer unlock()
+
+	info, offset, err := t.load(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	if len(info.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatTusMetadata(info.Metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch appends the request body at Upload-Offset.
+func (t *tusStore) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	unlock := t.lock(id)
+	defer unlock()
+
+	info, offset, err := t.load(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if clientOffset != offset || info.Completed {
+		http.Error(w, "Upload-Offset mismatch", http.StatusConflict)
+		return
+	}
+
+	f, err := os.OpenFile(t.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Println("❌ Failed to open upload data file:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// An interrupted PATCH keeps what arrived, so the upload can resume
+	transfer := t.transfers.begin(r, "upload", info.filename())
+	transfer.resumable()
+	defer transfer.end()
+
+	// Never accept more than the declared length
+	progress := newProgressReader(eventsFor(r), io.LimitReader(r.Body, info.Length-offset), info.filename(), offset, info.Length)
+	dst := &tusWriter{f: f}
+	written, copyErr := io.Copy(dst, progress)
+	writeErr := dst.err
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	progress.Finish()
+
+	if writeErr != nil {
+		// The chunk is refused whole; the client sends it again from the
+		// old offset once there is room
+		fmt.Printf("❌ Failed to write upload data for %s: %v\n", id, writeErr)
+		if err := os.Truncate(t.dataPath(id), offset); err != nil {
+			fmt.Println("⚠️ Failed to roll back upload data:", err)
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	offset += written
+	if copyErr != nil {
+		// Whatever arrived is kept; the client resumes from the new offset
+		fmt.Printf("⚠️ Resumable upload %s interrupted at %d/%d bytes: %v\n", id, offset, info.Length, copyErr)
+		return
+	}
+
+	if offset == info.Length {
+		if !t.complete(w, r, info) {
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate implements the termination extension (DELETE /files/{id}).
+func (t *tusStore) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := t.lock(id)
+	defer unlock()
+
+	info, _, err := t.load(id)
+	if err != nil || info.Completed {
+		http.NotFound(w, r)
+		return
+	}
+	t.discard(id)
+
+	fmt.Printf("🗑️ Resumable upload terminated: %s\n", id)
+	emitFileFailed(r, info.filename(), info.CreatedAt, errors.New("upload cancelled by sender"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete finalizes an upload and answers the request if that fails.
+// It reports whether the handler may go on writing a success response.
+func (t *tusStore) complete(w http.ResponseWriter, r *http.Request, info tusInfo) bool {
+	err := t.finish(r, info)
+	if err == nil {
+		return true
+	}
+	t.discard(info.ID)
+
+	var sumErr *checksumError
+	if errors.As(err, &sumErr) {
+		emitIntegrityFailed(r, info.filename(), info.CreatedAt, sumErr)
+		http.Error(w, "Checksum mismatch", StatusChecksumMismatch)
+		return false
+	}
+
+	fmt.Println("❌ Failed to finalize upload:", err)
+	emitFileFailed(r, info.filename(), info.CreatedAt, err)
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	return false
+}
+
+// finish verifies a completed upload and moves it into uploadDir.
+func (t *tusStore) finish(r *http.Request, info tusInfo) error {
+	filename := info.filename()
+	if err := syncFile(t.dataPath(info.ID)); err != nil {
+		return err
+	}
+
+	// The whole file is hashed here because a resumed upload may have
+	// arrived over several requests or even several receiver runs.
+	sum, err := hashFile(t.dataPath(info.ID))
+	if err != nil {
+		return err
+	}
+	if err := verifySHA256(info.Metadata["sha256"], sum); err != nil {
+		return err
+	}
+
+	dir, name, err := prepareUploadTarget(t.uploadDir, filename)
+	if err != nil {
+		return err
+	}
+
+	finalName, err := placeFile(dir, name, t.policy, info.modTime(), func(dstPath string) error {
+		fmt.Printf("💾 Saving to: %s\n", dstPath)
+		return os.Rename(t.dataPath(info.ID), dstPath)
+	})
+	skipped := errors.Is(err, errFileSkipped)
+	if err != nil && !skipped {
+		return err
+	}
+	if skipped {
+		os.Remove(t.dataPath(info.ID))
+	}
+
+	info.Completed = true
+	if err := t.writeInfo(info); err != nil {
+		fmt.Println("⚠️ Failed to mark upload complete:", err)
+	}
+
+	if skipped {
+		fmt.Printf("⏭️ Skipped existing file: %s\n", filename)
+		eventsFor(r).emit(FileSkipped{Name: filename, Device: deviceName(r), StartedAt: info.CreatedAt})
+		return nil
+	}
+
+	savedPath := filepath.Join(dir, finalName)
+	finalName = path.Join(path.Dir(filename), finalName)
+	fmt.Printf("✅ File saved: %s (%d bytes)\n", finalName, info.Length)
+	eventsFor(r).emit(FileReceived{
+		Name:      finalName,
+		Path:      savedPath,
+		Size:      info.Length,
+		SHA256:    sum,
+		Device:    deviceName(r),
+		StartedAt: info.CreatedAt,
+	})
+	return nil
+}
+
+// syncFile flushes a finished upload to disk before it is renamed into place.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// tusWriter remembers a failed write, so patch can tell a full disk from a
+// client that went away.
+type tusWriter struct {
+	f   *os.File
+	err error
+}
+
+func (w *tusWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (t *tusStore) discard(id string) {
+	os.Remove(t.dataPath(id))
+	os.Remove(t.infoPath(id))
+}
+
+// load reads the persisted info and derives the offset from the data file.
+func (t *tusStore) load(id string) (tusInfo, int64, error) {
+	var info tusInfo
+
+	raw, err := os.ReadFile(t.infoPath(id))
+	if err != nil {
+		return info, 0, err
+	}
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return info, 0, err
+	}
+	if info.Completed {
+		return info, info.Length, nil
+	}
+
+	stat, err := os.Stat(t.dataPath(id))
+	if err != nil {
+		return info, 0, err
+	}
+	return info, stat.Size(), nil
+}
+
+func (t *tusStore) writeInfo(info tusInfo) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.infoPath(info.ID), raw, 0644)
+}
+
+func newTusID() (string, error) {
+	return randomHex(16)
+}
+
+func validTusID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// parseTusMetadata decodes "key base64value,key2 base64value2".
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("malformed metadata pair")
+		}
+	}
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if value == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,91 @@
+package beamsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUpload persists a partial upload of length bytes holding data.
+func newTestUpload(t *testing.T, store *tusStore, length int64, data string) string {
+	t.Helper()
+	id, err := newTusID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := tusInfo{ID: id, Length: length, Metadata: map[string]string{"filename": "a.bin"}, CreatedAt: time.Now()}
+	if err := store.writeInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.dataPath(id), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestTusPrunesIdleUploads(t *testing.T) {
+	store, err := newTusStore(t.TempDir(), CollisionRename, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := newTestUpload(t, store, 10, "abc")
+	active := newTestUpload(t, store, 10, "abc")
+	old := time.Now().Add(-tusIdleTTL - time.Hour)
+	for _, path := range []string{store.dataPath(idle), store.infoPath(idle)} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store.prune()
+
+	if _, err := os.Stat(store.dataPath(idle)); !os.IsNotExist(err) {
+		t.Error("idle upload data kept")
+	}
+	if _, err := os.Stat(store.infoPath(idle)); !os.IsNotExist(err) {
+		t.Error("idle upload info kept")
+	}
+	if _, _, err := store.load(active); err != nil {
+		t.Errorf("active upload pruned: %v", err)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("%d locks left after pruning", len(store.locks))
+	}
+}
+
+// TestTusPatchWriteFailure checks a chunk the disk refuses is answered with
+// 500 and doesn't move the offset.
+func TestTusPatchWriteFailure(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to simulate a full disk")
+	}
+	store, err := newTusStore(t.TempDir(), CollisionRename, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := newTestUpload(t, store, 10, "")
+	os.Remove(store.dataPath(id))
+	if err := os.Symlink("/dev/full", store.dataPath(id)); err != nil {
+		t.Skip("can't link /dev/full:", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPatch, tusBasePath+id, strings.NewReader("0123456789"))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	r.Header.Set("Upload-Offset", "0")
+	w := httptest.NewRecorder()
+	store.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if w.Header().Get("Upload-Offset") != "" {
+		t.Errorf("reported offset %q for a refused chunk", w.Header().Get("Upload-Offset"))
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("%d locks left after the request", len(store.locks))
+	}
+}
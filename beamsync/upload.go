@@ -0,0 +1,259 @@
+package beamsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// uploadHandler streams multipart uploads straight into uploadDir.
+// Parts are read one at a time with r.MultipartReader(), so nothing is
+// spooled to memory or temp files before reaching its final location.
+// With approvals, nothing is written until the desktop accepts the upload.
+// The request counts as one transfer in transfers, named after its current file.
+func uploadHandler(uploadDir string, policy CollisionPolicy, approvals *Approvals, transfers *transferTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println("📤 POST /upload - Upload started")
+
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Printf("❌ PANIC in upload handler: %v\n", r)
+				fmt.Printf("Stack trace:\n%s\n", debug.Stack())
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			fmt.Println("❌ Failed to open multipart stream:", err)
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Println("✅ Multipart stream opened")
+
+		var transfer *activeTransfer
+		defer func() { transfer.end() }()
+
+		count := 0
+		approved := false
+		expectedSum := ""
+		var modTime time.Time
+		var mismatched []string
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				fmt.Println("❌ Failed to read multipart part:", err)
+				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				return
+			}
+
+			// A "sha256" field applies to the file part that follows it
+			if part.FormName() == "sha256" && part.FileName() == "" {
+				value, _ := io.ReadAll(io.LimitReader(part, 128))
+				part.Close()
+				if expectedSum, err = normalizeSHA256(string(value)); err != nil {
+					http.Error(w, "Invalid sha256", http.StatusBadRequest)
+					return
+				}
+				continue
+			}
+
+			// So does a "lastModified" field, in Unix milliseconds
+			if part.FormName() == "lastModified" && part.FileName() == "" {
+				value, _ := io.ReadAll(io.LimitReader(part, 32))
+				part.Close()
+				modTime = parseLastModified(string(value))
+				continue
+			}
+
+			// Only file parts of the "documents" field carry payload
+			if part.FormName() != "documents" || part.FileName() == "" {
+				part.Close()
+				continue
+			}
+
+			count++
+			rawName := partFileName(part)
+			fmt.Printf("📄 Processing file #%d: %s\n", count, rawName)
+
+			// Folder uploads keep their relative path; traversal is refused
+			filename, err := uploadName(rawName, fmt.Sprintf("upload_%d.bin", time.Now().Unix()))
+			if err != nil {
+				part.Close()
+				fmt.Printf("🚫 Rejected upload path %q: %v\n", rawName, err)
+				http.Error(w, "Invalid file path", http.StatusBadRequest)
+				return
+			}
+
+			// Unannounced uploads pause here; the request size stands in for
+			// the file size, which multipart doesn't tell us up front, and
+			// bounds the rest of the request. Announced files may not grow
+			// past the size they were approved at.
+			limit := int64(-1)
+			if !approved {
+				var claimed bool
+				if limit, claimed = approvals.claim(r, filename); !claimed {
+					if _, ok := approvals.authorize(w, r, IncomingFile{Name: filename, Size: r.ContentLength}); !ok {
+						part.Close()
+						return
+					}
+					approved = true
+				}
+			}
+
+			if transfer == nil {
+				transfer = transfers.begin(r, "upload", filename)
+			} else {
+				transfer.rename(filename)
+			}
+
+			// Multipart parts don't announce their size, so total is unknown
+			started := time.Now()
+			progress := newProgressReader(eventsFor(r), limitApproved(part, limit), filename, 0, -1)
+			finalName, written, sum, err := receivePart(progress, uploadDir, filename, expectedSum, modTime, policy)
+			part.Close()
+			expectedSum = ""
+			modTime = time.Time{}
+
+			var sumErr *checksumError
+			if errors.As(err, &sumErr) {
+				emitIntegrityFailed(r, filename, started, sumErr)
+				mismatched = append(mismatched, filename)
+				continue
+			}
+			if errors.Is(err, errUnsafePath) {
+				fmt.Printf("🚫 Rejected upload path %q: %v\n", rawName, err)
+				http.Error(w, "Invalid file path", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, errExceedsApproval) {
+				fmt.Printf("🚫 %s is larger than the %d bytes approved\n", filename, limit)
+				emitFileFailed(r, filename, started, err)
+				http.Error(w, "File larger than approved", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if errors.Is(err, errFileSkipped) {
+				fmt.Printf("⏭️ Skipped existing file: %s\n", filename)
+				eventsFor(r).emit(FileSkipped{Name: filename, Device: deviceName(r), StartedAt: started})
+				continue
+			}
+			if err != nil {
+				fmt.Println("❌ Copy error:", err)
+				if !transfer.aborted() {
+					emitFileFailed(r, filename, started, err)
+				}
+				continue
+			}
+			progress.Finish()
+
+			fmt.Printf("✅ File saved: %s (%d bytes)\n", finalName, written)
+			eventsFor(r).emit(FileReceived{
+				Name:      finalName,
+				Path:      filepath.Join(uploadDir, filepath.FromSlash(finalName)),
+				Size:      written,
+				SHA256:    sum,
+				Device:    deviceName(r),
+				StartedAt: started,
+			})
+		}
+
+		if count == 0 {
+			http.Error(w, "No files uploaded", http.StatusBadRequest)
+			return
+		}
+
+		if len(mismatched) > 0 {
+			http.Error(w, "Checksum mismatch: "+strings.Join(mismatched, ", "), StatusChecksumMismatch)
+			return
+		}
+
+		fmt.Println("✅ Upload handler completed successfully")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("✅ Upload Complete"))
+		fmt.Println("🔄 Server still running, waiting for more requests...")
+	}
+}
+
+// receivePart streams a single multipart part into a hidden ".part" file
+// next to its destination, fsyncs it, and only then renames it into place
+// under the collision policy, which compares modTime for
+// CollisionKeepNewer. A failed copy or SHA-256 mismatch never leaves a
+// truncated file behind that looks complete. It returns the final name,
+// the size and the SHA-256 of what was written.
+func receivePart(src io.Reader, uploadDir, rel, expectedSum string, modTime time.Time, policy CollisionPolicy) (string, int64, string, error) {
+	dir, filename, err := prepareUploadTarget(uploadDir, rel)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filename+".*.part")
+	if err != nil {
+		return "", 0, "", fmt.Errorf("file creation error: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", written, "", err
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if err := verifySHA256(expectedSum, sum); err != nil {
+		os.Remove(tmpPath)
+		return "", written, sum, err
+	}
+
+	finalName, err := placeFile(dir, filename, policy, modTime, func(dstPath string) error {
+		fmt.Printf("💾 Saving to: %s\n", dstPath)
+		return os.Rename(tmpPath, dstPath)
+	})
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", written, sum, err
+	}
+	return path.Join(path.Dir(rel), finalName), written, sum, nil
+}
+
+// partFileName returns the filename exactly as sent. Part.FileName strips
+// directories, which would flatten folder uploads.
+func partFileName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return part.FileName()
+	}
+	return params["filename"]
+}
+
+// emitFileFailed reports an upload that was cut off and cleaned up.
+func emitFileFailed(r *http.Request, filename string, started time.Time, reason error) {
+	eventsFor(r).emit(TransferFailed{Name: filename, Direction: "upload", Reason: reason.Error(),
+		Device: deviceName(r), StartedAt: started})
+}
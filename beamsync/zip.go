@@ -0,0 +1,215 @@
+package beamsync
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Zip downloads are written with stored (uncompressed) entries through
+// zip.Writer.CreateRaw. Every header is fixed before any data is read, so
+// the archive length can be computed up front by a dry run that skips
+// the file contents, and mobile browsers get a real Content-Length.
+
+// zipEntry is one file or directory inside a zip download.
+type zipEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+// zipEntriesFor lists root as entries under prefix/.
+func zipEntriesFor(root, prefix string) ([]zipEntry, error) {
+	var entries []zipEntry
+	err := walkShared(root, func(p, rel string, info fs.FileInfo) error {
+		entries = append(entries, zipEntry{name: path.Join(prefix, rel), path: p, info: info})
+		return nil
+	})
+	return entries, err
+}
+
+// downloadAllHandler streams every shared file and folder as one zip.
+func downloadAllHandler(filePaths []string, isDir []bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Shared items come from different folders, so top-level names can clash
+		used := make(map[string]bool)
+		var entries []zipEntry
+		for i, p := range filePaths {
+			name := uniqueEntryName(used, filepath.Base(p))
+			if isDir[i] {
+				dirEntries, err := zipEntriesFor(p, name)
+				if err != nil {
+					http.Error(w, "Folder unavailable", http.StatusInternalServerError)
+					return
+				}
+				entries = append(entries, dirEntries...)
+				continue
+			}
+
+			info, err := os.Stat(p)
+			if err != nil {
+				http.Error(w, "File unavailable", http.StatusInternalServerError)
+				return
+			}
+			entries = append(entries, zipEntry{name: name, path: p, info: info})
+		}
+
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		w.Header().Set("Content-Disposition", `attachment; filename="BeamSync.zip"`)
+		fmt.Printf("📦 Streaming %d shared item(s) as one zip\n", len(filePaths))
+		serveZip(w, r, entries)
+	}
+}
+
+func uniqueEntryName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 1; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// serveZip answers with the archive of entries, announcing its exact size.
+func serveZip(w http.ResponseWriter, r *http.Request, entries []zipEntry) {
+	size, err := zipSize(entries)
+	if err != nil {
+		http.Error(w, "Archive unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Headers are long gone by now; the client sees a truncated archive
+	if err := writeZip(w, entries, false); err != nil {
+		fmt.Printf("❌ Zip stream aborted: %v\n", err)
+	}
+}
+
+// zipSize returns the exact length writeZip will produce for entries.
+func zipSize(entries []zipEntry) (int64, error) {
+	counter := &countingWriter{}
+	if err := writeZip(counter, entries, true); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// writeZip streams entries as a zip. In a dry run file contents are
+// replaced by zeros of the same length and nothing is read from disk.
+func writeZip(w io.Writer, entries []zipEntry, dryRun bool) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		fh, err := zipHeader(entry)
+		if err != nil {
+			return err
+		}
+
+		dst, err := zw.CreateRaw(fh)
+		if err != nil {
+			return err
+		}
+		if entry.info.IsDir() {
+			continue
+		}
+
+		if dryRun {
+			if err := writeZeros(dst, entry.info.Size()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The data descriptor is written when the next entry starts, so
+		// the checksum only has to be known once the data has been copied.
+		crc := crc32.NewIEEE()
+		if err := copyFileTo(io.MultiWriter(dst, crc), entry.path, entry.info.Size()); err != nil {
+			return err
+		}
+		fh.CRC32 = crc.Sum32()
+	}
+
+	return zw.Close()
+}
+
+// zipHeader builds a stored header whose sizes are known in advance.
+func zipHeader(entry zipEntry) (*zip.FileHeader, error) {
+	fh, err := zip.FileInfoHeader(entry.info)
+	if err != nil {
+		return nil, err
+	}
+
+	fh.Name = entry.name
+	fh.Method = zip.Store
+	fh.Flags |= 0x800 // names are UTF-8
+	fh.ReaderVersion = 20
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | 20
+	fh.ModifiedDate, fh.ModifiedTime = msDosTime(entry.info.ModTime())
+
+	if entry.info.IsDir() {
+		fh.Name += "/"
+		fh.UncompressedSize64 = 0
+		fh.CompressedSize64 = 0
+		return fh, nil
+	}
+
+	fh.Flags |= 0x8 // CRC follows the data in a descriptor
+	fh.UncompressedSize64 = uint64(entry.info.Size())
+	fh.CompressedSize64 = fh.UncompressedSize64
+	return fh, nil
+}
+
+// msDosTime encodes t the way zip headers store modification times.
+func msDosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+var zeroBlock = make([]byte, 64*1024)
+
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		chunk := int64(len(zeroBlock))
+		if n < chunk {
+			chunk = n
+		}
+		if _, err := w.Write(zeroBlock[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -5,12 +5,16 @@ import (
 	"beamsync/audio"
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	stdruntime "runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -25,31 +29,41 @@ type App struct {
 	audio        *audio.AudioEngine
 	serverApp    *beamsync.HTTPServer
 	senderApp    *beamsync.HTTPServer
-	eventChan    chan EventData
+	pairing      *beamsync.Pairing
+	settings     Settings
+	settingsPath string
+	identity     *beamsync.TLSIdentity
+	approvals    *beamsync.Approvals
+	peers        []beamsync.Peer
+	events       *beamsync.Subscription
+	history      *beamsync.History
+	historySub   *beamsync.Subscription
 	lastSavePath string
+	sharedPaths  []string
 	currentIP    string
 	currentPort  string
 }
 
-// EventData holds event information
-type EventData struct {
-	Name string
-	Data string
-}
-
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{
-		eventChan: make(chan EventData, 100), // Buffered channel
-	}
+	return &App{}
 }
 
 // startup is called when the app starts
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	// Start event processor on main thread
-	go a.processEvents()
+	// Preferences first; they decide ports, folders and sounds below
+	a.openSettings()
+
+	// Library events are forwarded to the frontend as objects, in order;
+	// progress is dropped rather than stalling transfers if the UI lags
+	a.events = beamsync.Subscribe(a.forwardEvent, beamsync.SubscribeOptions{
+		Overflow: beamsync.OverflowDropProgress,
+	})
+
+	// Every finished, failed or skipped file lands in the history
+	a.openHistory()
 
 	// Start IP Monitor
 	go a.startIPMonitor()
@@ -87,25 +101,25 @@ func (a *App) startup(ctx context.Context) {
 	}
 }
 
-// processEvents handles events on a safe goroutine
-func (a *App) processEvents() {
-	for event := range a.eventChan {
-		// Intercept device_connected to re-verify IP
-		if event.Name == "device_connected" {
-			currentRealIP := getLocalIP()
-			if a.currentIP != "" && a.currentIP != currentRealIP {
-				fmt.Printf("🔄 IP Change Detected! Old: %s, New: %s\n", a.currentIP, currentRealIP)
-				a.currentIP = currentRealIP
-				newURL := fmt.Sprintf("http://%s:%s", a.currentIP, a.currentPort)
-				a.safeEmit("url_changed", newURL)
-			}
+// forwardEvent passes a library event on to the frontend, with the ID of
+// the server it came from ("receiver", "sender" or "" for peer sends) as a
+// second argument; the subscription calls it one event at a time
+func (a *App) forwardEvent(instance string, event beamsync.Event) {
+	// Intercept device_connected to re-verify IP
+	if _, ok := event.(beamsync.DeviceConnected); ok {
+		currentRealIP := getLocalIP()
+		if a.currentIP != "" && a.currentIP != currentRealIP {
+			fmt.Printf("🔄 IP Change Detected! Old: %s, New: %s\n", a.currentIP, currentRealIP)
+			a.currentIP = currentRealIP
+			newURL := a.shareURL(a.currentIP, a.currentPort)
+			a.safeEmit("url_changed", newURL)
 		}
-		a.safeEmit(event.Name, event.Data)
 	}
+	a.safeEmit(event.EventName(), event, instance)
 }
 
 // safeEmit safely emits an event to the frontend, handling panics and nil context
-func (a *App) safeEmit(eventName string, data interface{}) {
+func (a *App) safeEmit(eventName string, data ...interface{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("⚠️ safeEmit panic for event '%s': %v\n", eventName, r)
@@ -117,31 +131,59 @@ func (a *App) safeEmit(eventName string, data interface{}) {
 		return
 	}
 
-	runtime.EventsEmit(a.ctx, eventName, data)
+	runtime.EventsEmit(a.ctx, eventName, data...)
 	fmt.Printf("✅ Event emitted: %s\n", eventName)
 }
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
-	close(a.eventChan)
+	// The window is going away; stop forwarding before the servers close
+	a.events.Close()
 
+	defer func() {
+		// Let the history record what the closing servers reported
+		a.historySub.Close()
+		if a.historySub != nil {
+			select {
+			case <-a.historySub.Done():
+			case <-time.After(2 * time.Second):
+			}
+		}
+	}()
+
+	// Both get stopGrace at once, as confirmStop promised before quitting
+	var wg sync.WaitGroup
 	if a.serverApp != nil {
 		fmt.Println("🛑 Shutting down receiver server...")
-		if err := a.serverApp.Shutdown(); err != nil {
-			fmt.Println("⚠️ Server shutdown error:", err)
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.stopServer(a.serverApp); err != nil {
+				fmt.Println("⚠️ Server shutdown error:", err)
+			}
+		}()
 	}
 	if a.senderApp != nil {
 		fmt.Println("🛑 Shutting down sender server...")
-		if err := a.senderApp.Shutdown(); err != nil {
-			fmt.Println("⚠️ Sender shutdown error:", err)
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.stopServer(a.senderApp); err != nil {
+				fmt.Println("⚠️ Sender shutdown error:", err)
+			}
+		}()
 	}
+	wg.Wait()
+}
+
+// beforeClose asks before quitting while transfers are still running
+func (a *App) beforeClose(ctx context.Context) (prevent bool) {
+	return !a.confirmStop(a.serverApp, a.senderApp)
 }
 
 // PlaySound exposed to Frontend
 func (a *App) PlaySound(name string) {
-	if a.audio != nil {
+	if a.audio != nil && a.settings.Sounds {
 		a.audio.Play(name)
 	}
 }
@@ -150,52 +192,33 @@ func (a *App) PlaySound(name string) {
 // BRIDGE METHODS
 // ---------------------------------------------------------
 
-// StartReceiverDefault: silent startup using Downloads folder
+// StartReceiverDefault: silent startup using the save folder from settings
 func (a *App) StartReceiverDefault() string {
 	if a.serverApp != nil {
+		if !a.confirmStop(a.serverApp) {
+			return "Cancelled"
+		}
 		fmt.Println("🔄 Stopping previous receiver server...")
-		if err := a.serverApp.Shutdown(); err != nil {
+		if err := a.stopServer(a.serverApp); err != nil {
 			fmt.Println("⚠️ Failed to stop previous server:", err)
 		}
 		a.serverApp = nil
 	}
 
-	home, err := os.UserHomeDir()
-	savePath := "received_files"
-	if err == nil {
-		savePath = filepath.Join(home, "Downloads", "BeamSync")
-	}
-
+	savePath := a.settings.SaveDir
 	a.lastSavePath = savePath // Store for OpenFile
 
-	if err := os.MkdirAll(savePath, 0755); err != nil {
-		fmt.Println("⚠️ Failed to create save directory:", err)
-		return "Error: Could not create save directory"
-	}
-
-	// Setup callback - Thread-safe via Channel
-	beamsync.SetEventCallback(func(name string, data string) {
-		a.eventChan <- EventData{Name: name, Data: data}
-	})
-
-	app, port := beamsync.StartServer(savePath, 3000)
-	a.serverApp = app
-
-	localIP := getLocalIP()
-	url := "http://" + localIP + ":" + port
-
-	a.currentIP = localIP
-	a.currentPort = port
-
-	fmt.Println("📡 Receiver started:", url)
-	return url
+	return a.launchReceiver(savePath)
 }
 
 // StartReceiver: Tells the Brain to listen for files
 func (a *App) StartReceiver() string {
 	if a.serverApp != nil {
+		if !a.confirmStop(a.serverApp) {
+			return "Cancelled"
+		}
 		fmt.Println("🔄 Stopping previous receiver server...")
-		if err := a.serverApp.Shutdown(); err != nil {
+		if err := a.stopServer(a.serverApp); err != nil {
 			fmt.Println("⚠️ Failed to stop previous server:", err)
 		}
 		a.serverApp = nil
@@ -211,16 +234,31 @@ func (a *App) StartReceiver() string {
 
 	a.lastSavePath = selection // Store for OpenFile
 
-	// Setup callback - Thread-safe via Channel
-	beamsync.SetEventCallback(func(name string, data string) {
-		a.eventChan <- EventData{Name: name, Data: data}
-	})
+	return a.launchReceiver(selection)
+}
 
-	app, port := beamsync.StartServer(selection, 3000)
+// launchReceiver starts receiving into savePath and returns the URL to share
+func (a *App) launchReceiver(savePath string) string {
+	a.approvals = a.newApprovals()
+	app := beamsync.NewReceiver(beamsync.ReceiverOptions{
+		ID:        "receiver",
+		UploadDir: savePath,
+		Port:      a.settings.ReceiverPorts.First,
+		MaxPort:   a.settings.ReceiverPorts.Last,
+		Collision: a.settings.Collision,
+		Pairing:   a.ensurePairing(),
+		Identity:  a.ensureIdentity(),
+		Approvals: a.approvals,
+	})
+	if err := app.Start(a.ctx); err != nil {
+		fmt.Println("❌ Receiver failed to start:", err)
+		return startError(err, savePath)
+	}
 	a.serverApp = app
 
 	localIP := getLocalIP()
-	url := "http://" + localIP + ":" + port
+	port := strconv.Itoa(app.Port())
+	url := a.shareURL(localIP, port)
 
 	a.currentIP = localIP
 	a.currentPort = port
@@ -232,8 +270,11 @@ func (a *App) StartReceiver() string {
 // StartSender: Asks user for a file, then tells Brain to host it
 func (a *App) StartSender() string {
 	if a.senderApp != nil {
+		if !a.confirmStop(a.senderApp) {
+			return "Cancelled"
+		}
 		fmt.Println("🔄 Stopping previous sender server...")
-		if err := a.senderApp.Shutdown(); err != nil {
+		if err := a.stopServer(a.senderApp); err != nil {
 			fmt.Println("⚠️ Failed to stop previous sender:", err)
 		}
 		a.senderApp = nil
@@ -247,11 +288,53 @@ func (a *App) StartSender() string {
 		return "Cancelled"
 	}
 
-	app, port := beamsync.StartSender(selection)
+	return a.launchSender(selection)
+}
+
+// StartSenderFolder: Asks user for a folder, then hosts it as a browsable archive
+func (a *App) StartSenderFolder() string {
+	if a.senderApp != nil {
+		if !a.confirmStop(a.senderApp) {
+			return "Cancelled"
+		}
+		fmt.Println("🔄 Stopping previous sender server...")
+		if err := a.stopServer(a.senderApp); err != nil {
+			fmt.Println("⚠️ Failed to stop previous sender:", err)
+		}
+		a.senderApp = nil
+	}
+
+	selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Folder to Send",
+	})
+
+	if err != nil || selection == "" {
+		return "Cancelled"
+	}
+
+	return a.launchSender([]string{selection})
+}
+
+// launchSender hosts the given files or folders and announces the URL
+func (a *App) launchSender(paths []string) string {
+	app := beamsync.NewSender(beamsync.SenderOptions{
+		ID:       "sender",
+		Paths:    paths,
+		Port:     a.settings.SenderPorts.First,
+		MaxPort:  a.settings.SenderPorts.Last,
+		Pairing:  a.ensurePairing(),
+		Identity: a.ensureIdentity(),
+	})
+	if err := app.Start(a.ctx); err != nil {
+		fmt.Println("❌ Sender failed to start:", err)
+		return startError(err, "")
+	}
 	a.senderApp = app
+	a.sharedPaths = paths
 
 	localIP := getLocalIP()
-	url := "http://" + localIP + ":" + port
+	port := strconv.Itoa(app.Port())
+	url := a.shareURL(localIP, port)
 
 	a.currentIP = localIP
 	a.currentPort = port
@@ -265,19 +348,93 @@ func (a *App) StartSender() string {
 	fmt.Println("========================================")
 
 	// Emit event to frontend with the URL
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		a.safeEmit("sender_started", url)
-	}()
+	a.safeEmit("sender_started", url)
 
 	return url
 }
 
+// OfferFileToDevice: Asks user for a file and offers it to a phone that has the
+// receiver page open; an empty deviceID offers it to every connected phone
+func (a *App) OfferFileToDevice(deviceID string) string {
+	if a.serverApp == nil {
+		return "Error: Receiver not running"
+	}
+
+	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select File to Offer",
+	})
+
+	if err != nil || selection == "" {
+		return "Cancelled"
+	}
+
+	if err := a.serverApp.OfferFile(deviceID, selection); err != nil {
+		if errors.Is(err, beamsync.ErrDeviceUnreachable) {
+			return "Error: Device not reachable"
+		}
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return "Offered " + filepath.Base(selection)
+}
+
+// stopGrace is how long running transfers get to finish when a server stops
+const stopGrace = 10 * time.Second
+
+// stopServer lets running transfers finish, up to stopGrace, then stops the
+// server; the library announces any it cut off with transfer_aborted
+func (a *App) stopServer(s *beamsync.HTTPServer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), stopGrace)
+	defer cancel()
+	aborted, err := s.Shutdown(ctx)
+	if len(aborted) > 0 {
+		fmt.Printf("✂️ %d transfer(s) cut off\n", len(aborted))
+	}
+	return err
+}
+
+// GetActiveTransfers: Uploads and downloads in progress on either server
+func (a *App) GetActiveTransfers() []beamsync.Transfer {
+	return append(a.serverApp.ActiveTransfers(), a.senderApp.ActiveTransfers()...)
+}
+
+// ConfirmStop: Asks before stopping while transfers are running; true means
+// nothing is running or the user agreed
+func (a *App) ConfirmStop() bool {
+	return a.confirmStop(a.serverApp, a.senderApp)
+}
+
+func (a *App) confirmStop(servers ...*beamsync.HTTPServer) bool {
+	var names []string
+	for _, s := range servers {
+		for _, t := range s.ActiveTransfers() {
+			names = append(names, t.Name)
+		}
+	}
+	if len(names) == 0 {
+		return true
+	}
+	if len(names) > 3 {
+		names = append(names[:3], fmt.Sprintf("and %d more", len(names)-3))
+	}
+
+	choice, err := runtime.MessageDialog(a.ctx, runtime.MessageDialogOptions{
+		Type:  runtime.QuestionDialog,
+		Title: "Transfers in progress",
+		Message: fmt.Sprintf("Still transferring %s.\n\nStop anyway? Transfers get %d seconds to finish before they are cut off.",
+			strings.Join(names, ", "), int(stopGrace.Seconds())),
+	})
+	if err != nil {
+		fmt.Println("⚠️ Stop confirmation failed:", err)
+		return false
+	}
+	return choice == "Yes"
+}
+
 // StopReceiver: Stop the receiver server
 func (a *App) StopReceiver() string {
 	if a.serverApp != nil {
 		fmt.Println("🛑 Stopping receiver server...")
-		if err := a.serverApp.Shutdown(); err != nil {
+		if err := a.stopServer(a.serverApp); err != nil {
 			return "Error stopping server"
 		}
 		a.serverApp = nil
@@ -290,7 +447,7 @@ func (a *App) StopReceiver() string {
 func (a *App) StopSender() string {
 	if a.senderApp != nil {
 		fmt.Println("🛑 Stopping sender server...")
-		if err := a.senderApp.Shutdown(); err != nil {
+		if err := a.stopServer(a.senderApp); err != nil {
 			return "Error stopping sender"
 		}
 		a.senderApp = nil
@@ -306,18 +463,139 @@ func (a *App) ResetApp() {
 	a.StopSender()
 	a.serverApp = nil
 	a.senderApp = nil
+	// A fresh session gets a fresh PIN; previously paired phones must pair again
+	a.pairing = nil
 	// We don't reset IP/Port here because we might want to restart immediately
 	// But we should probably clear the currentPort so IP monitor doesn't emit url_changed
 	a.currentPort = ""
 }
 
+// GetPairingPIN returns the PIN phones must enter when not using the QR code
+func (a *App) GetPairingPIN() string {
+	return a.ensurePairing().PIN()
+}
+
+// SetSecureMode switches HTTPS on or off and remembers it; it applies from the next start
+func (a *App) SetSecureMode(enabled bool) {
+	a.settings.SecureMode = enabled
+	a.persistSettings()
+	fmt.Println("🔏 Secure mode:", enabled)
+}
+
+// GetCertificateFingerprint returns the SHA-256 fingerprint phones should see,
+// or "" when serving plain HTTP
+func (a *App) GetCertificateFingerprint() string {
+	return a.ensureIdentity().DisplayFingerprint()
+}
+
+// SetApprovalMode makes the receiver ask before accepting files and remembers it;
+// it applies from the next start
+func (a *App) SetApprovalMode(enabled bool) {
+	a.settings.AskApproval = enabled
+	a.persistSettings()
+	fmt.Println("✋ Approval mode:", enabled)
+}
+
+// RespondToRequest accepts or declines an incoming_request by its ID
+func (a *App) RespondToRequest(id string, accept bool) string {
+	if !a.approvals.Respond(id, accept) {
+		return "Error: Request expired"
+	}
+	if accept {
+		return "Accepted"
+	}
+	return "Declined"
+}
+
+// GetDevices lists the devices connected to the receiver and the sender
+func (a *App) GetDevices() []beamsync.Device {
+	devices := append([]beamsync.Device{}, a.serverApp.Devices()...)
+	return append(devices, a.senderApp.Devices()...)
+}
+
+// DiscoverPeers browses the LAN for other BeamSync receivers
+func (a *App) DiscoverPeers() []beamsync.Peer {
+	found, err := beamsync.DiscoverPeers(a.ctx, 2*time.Second)
+	if err != nil {
+		fmt.Println("⚠️ Peer discovery failed:", err)
+	}
+
+	self := a.serverApp.AdvertisedName()
+	peers := []beamsync.Peer{}
+	for _, peer := range found {
+		if peer.Role != "receiver" {
+			continue
+		}
+		// Skip our own receiver
+		if self != "" && peer.ID == self {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	a.peers = peers
+	fmt.Printf("🛰️ Found %d peer(s)\n", len(peers))
+	return peers
+}
+
+// SendToPeer: Asks user for files and uploads them straight to a peer found by
+// DiscoverPeers; pin is only needed when the peer asks for pairing
+func (a *App) SendToPeer(peerID string, pin string) string {
+	var peer *beamsync.Peer
+	for i := range a.peers {
+		if a.peers[i].ID == peerID {
+			peer = &a.peers[i]
+		}
+	}
+	if peer == nil {
+		return "Error: Peer not found"
+	}
+
+	selection, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select File(s) to Send to " + peer.Name,
+	})
+
+	if err != nil || len(selection) == 0 {
+		return "Cancelled"
+	}
+
+	client, err := beamsync.NewPeerClient(*peer)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	if pin != "" {
+		if err := client.Pair(a.ctx, pin); err != nil {
+			if errors.Is(err, beamsync.ErrWrongPIN) {
+				return "Error: Wrong PIN"
+			}
+			return fmt.Sprintf("Error: %v", err)
+		}
+	}
+
+	if err := client.Send(a.ctx, selection); err != nil {
+		switch {
+		case errors.Is(err, beamsync.ErrPairingRequired):
+			return "Error: Pairing required"
+		case errors.Is(err, beamsync.ErrTransferDeclined):
+			return "Error: Declined"
+		case errors.Is(err, beamsync.ErrApprovalTimeout):
+			return "Error: No answer"
+		}
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return fmt.Sprintf("Sent %d file(s) to %s", len(selection), peer.Name)
+}
+
 // OpenFile opens a file using the default system application.
 func (a *App) OpenFile(filename string) string {
 	if a.lastSavePath == "" {
 		return "Error: No active save directory"
 	}
 
-	fullPath := filepath.Join(a.lastSavePath, filepath.Base(filename))
+	// Folder uploads report paths like "trip/day1/a.jpg"; keep them inside the save dir
+	fullPath := filepath.Join(a.lastSavePath, filepath.FromSlash(filename))
+	if rel, err := filepath.Rel(a.lastSavePath, fullPath); err != nil || strings.HasPrefix(rel, "..") {
+		return "Error: Invalid file path"
+	}
 	fmt.Println("📂 Opening file:", fullPath)
 
 	var cmd *exec.Cmd
@@ -343,9 +621,266 @@ func (a *App) OpenFile(filename string) string {
 	return "File opened"
 }
 
+// GetSettings returns the current preferences
+func (a *App) GetSettings() Settings {
+	return a.settings
+}
+
+// UpdateSettings validates and saves new preferences and applies them at
+// once: sounds and auto-accept rules in place, the rest by restarting a
+// running receiver, announced with receiver_restarted, or receiver_failed
+// and the reason if it stays stopped. A running sender is shared again on
+// its new ports or scheme, announced with sender_started or sender_failed.
+func (a *App) UpdateSettings(s Settings) string {
+	s.Version = settingsVersion
+	if err := s.Validate(); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	old := a.settings
+
+	// A receiver on the default folder follows it; one on a folder picked
+	// with StartReceiver stays there
+	savePath := a.lastSavePath
+	if savePath == old.SaveDir {
+		savePath = s.SaveDir
+	}
+	restart := a.serverApp != nil && (savePath != a.lastSavePath ||
+		s.ReceiverPorts != old.ReceiverPorts || s.Collision != old.Collision ||
+		s.AskApproval != old.AskApproval || s.SecureMode != old.SecureMode)
+	// A running share moves to the new ports or scheme with the same files
+	reshare := a.senderApp != nil &&
+		(s.SenderPorts != old.SenderPorts || s.SecureMode != old.SecureMode)
+	var stopping []*beamsync.HTTPServer
+	if restart {
+		stopping = append(stopping, a.serverApp)
+	}
+	if reshare {
+		stopping = append(stopping, a.senderApp)
+	}
+	if !a.confirmStop(stopping...) {
+		return "Cancelled"
+	}
+
+	if a.settingsPath != "" {
+		if err := saveSettings(a.settingsPath, s); err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+	}
+	a.settings = s
+	a.approvals.SetAutoAccept(s.AutoAccept)
+	fmt.Println("⚙️ Settings updated")
+
+	if restart {
+		fmt.Println("🔄 Restarting receiver with new settings...")
+		if err := a.stopServer(a.serverApp); err != nil {
+			fmt.Println("⚠️ Failed to stop previous server:", err)
+		}
+		a.serverApp = nil
+		a.lastSavePath = savePath
+		result := a.launchReceiver(savePath)
+		if a.serverApp == nil {
+			a.safeEmit("receiver_failed", strings.TrimPrefix(result, "Error: "))
+		} else {
+			a.safeEmit("receiver_restarted", result)
+		}
+	}
+	if reshare {
+		fmt.Println("🔄 Restarting sender with new settings...")
+		if err := a.stopServer(a.senderApp); err != nil {
+			fmt.Println("⚠️ Failed to stop previous sender:", err)
+		}
+		a.senderApp = nil
+		// launchSender announces the new URL with sender_started
+		if result := a.launchSender(a.sharedPaths); a.senderApp == nil {
+			a.safeEmit("sender_failed", strings.TrimPrefix(result, "Error: "))
+		}
+	}
+	return "Settings saved"
+}
+
+// ChooseSaveFolder asks for a folder for the settings dialog; "" if cancelled
+func (a *App) ChooseSaveFolder() string {
+	selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:            "Select Default Folder for Received Files",
+		DefaultDirectory: a.settings.SaveDir,
+	})
+	if err != nil {
+		return ""
+	}
+	return selection
+}
+
+// ListHistory returns past transfers, newest first.
+func (a *App) ListHistory() []beamsync.HistoryEntry {
+	return a.history.List()
+}
+
+// SearchHistory returns past transfers matching every word of query.
+func (a *App) SearchHistory(query string) []beamsync.HistoryEntry {
+	return a.history.Search(query)
+}
+
+// ClearHistory forgets past transfers; the files themselves stay.
+func (a *App) ClearHistory() string {
+	if err := a.history.Clear(); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	fmt.Println("🧹 Transfer history cleared")
+	return "History cleared"
+}
+
+// RevealHistoryFile shows a history entry's file in the system file manager.
+func (a *App) RevealHistoryFile(id string) string {
+	entry, ok := a.history.Get(id)
+	if !ok {
+		return "Error: Unknown history entry"
+	}
+	if entry.Path == "" {
+		return "Error: No file was kept for this transfer"
+	}
+	if _, err := os.Stat(entry.Path); err != nil {
+		return "Error: File no longer exists"
+	}
+	fmt.Println("📂 Revealing file:", entry.Path)
+
+	var commandName string
+	var args []string
+
+	switch stdruntime.GOOS {
+	case "windows":
+		commandName = "explorer"
+		args = []string{"/select,", entry.Path}
+	case "darwin":
+		commandName = "open"
+		args = []string{"-R", entry.Path}
+	default: // linux, freebsd, openbsd, netbsd; no portable way to select
+		commandName = "xdg-open"
+		args = []string{filepath.Dir(entry.Path)}
+	}
+
+	if err := exec.Command(commandName, args...).Start(); err != nil {
+		return fmt.Sprintf("Error revealing file: %v", err)
+	}
+	return "File revealed"
+}
+
 // ---------------------------------------------------------
 // HELPER
 // ---------------------------------------------------------
+
+// openSettings loads the preferences, falling back to the defaults when
+// there is no config directory to keep them in
+func (a *App) openSettings() {
+	path, err := settingsPath()
+	if err != nil {
+		fmt.Println("⚠️ No config directory for settings:", err)
+		a.settings = defaultSettings()
+		return
+	}
+	a.settingsPath = path
+	a.settings = loadSettings(path)
+}
+
+// persistSettings saves the preferences after a single toggle changed them
+func (a *App) persistSettings() {
+	if a.settingsPath == "" {
+		return
+	}
+	if err := saveSettings(a.settingsPath, a.settings); err != nil {
+		fmt.Println("⚠️ Failed to save settings:", err)
+	}
+}
+
+// openHistory loads the transfer history from the config directory and
+// subscribes it to every server's events. Without it, nothing is recorded.
+func (a *App) openHistory() {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		fmt.Println("⚠️ No config directory for the history:", err)
+		return
+	}
+	history, err := beamsync.OpenHistory(filepath.Join(configDir, "beamsync", "history.jsonl"))
+	if err != nil {
+		fmt.Println("⚠️ Failed to open transfer history:", err)
+		return
+	}
+	a.history = history
+	// History writes to disk and ignores progress; dropping progress keeps
+	// a slow disk from holding up transfers
+	a.historySub = beamsync.Subscribe(history.Observe, beamsync.SubscribeOptions{
+		Overflow: beamsync.OverflowDropProgress,
+	})
+}
+
+// ensurePairing returns the pairing shared by receiver and sender,
+// creating it on first use
+func (a *App) ensurePairing() *beamsync.Pairing {
+	if a.pairing == nil {
+		pairing, err := beamsync.NewPairing()
+		if err != nil {
+			fmt.Println("⚠️ Failed to create pairing session:", err)
+			return nil
+		}
+		a.pairing = pairing
+	}
+	return a.pairing
+}
+
+// ensureIdentity loads the persisted certificate when secure mode is on
+func (a *App) ensureIdentity() *beamsync.TLSIdentity {
+	if !a.settings.SecureMode {
+		return nil
+	}
+	if a.identity == nil {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			fmt.Println("⚠️ No config directory for the certificate:", err)
+			return nil
+		}
+		identity, err := beamsync.LoadOrCreateIdentity(filepath.Join(configDir, "beamsync", "tls"))
+		if err != nil {
+			fmt.Println("⚠️ Failed to load certificate, falling back to HTTP:", err)
+			return nil
+		}
+		a.identity = identity
+	}
+	return a.identity
+}
+
+// newApprovals creates the approval queue for a receiver when approval mode is on
+func (a *App) newApprovals() *beamsync.Approvals {
+	if !a.settings.AskApproval {
+		return nil
+	}
+	approvals := beamsync.NewApprovals(60 * time.Second)
+	approvals.SetAutoAccept(a.settings.AutoAccept)
+	return approvals
+}
+
+// shareURL is the address encoded in the QR code, including the pairing token
+// and, in secure mode, the certificate fingerprint for pinning
+func (a *App) shareURL(ip, port string) string {
+	identity := a.ensureIdentity()
+	url := a.ensurePairing().URL(identity.Scheme() + "://" + ip + ":" + port)
+	if fp := identity.Fingerprint(); fp != "" {
+		url += "#fp=" + fp
+	}
+	return url
+}
+
+// startError explains why a receiver or sender couldn't start
+func startError(err error, saveDir string) string {
+	switch {
+	case errors.Is(err, beamsync.ErrPermissionDenied):
+		return "Error: Permission denied opening a network port. Allow BeamSync through your firewall and try again"
+	case errors.Is(err, beamsync.ErrNoFreePort):
+		return "Error: No free network port. Close other BeamSync windows and try again"
+	case errors.Is(err, beamsync.ErrUploadDir):
+		return fmt.Sprintf("Error: Cannot save files to %s. Choose another folder", saveDir)
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
 func getLocalIP() string {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
@@ -375,7 +910,7 @@ func (a *App) startIPMonitor() {
 
 				// Only emit update if we have an active port (server running)
 				if a.currentPort != "" {
-					newURL := fmt.Sprintf("http://%s:%s", a.currentIP, a.currentPort)
+					newURL := a.shareURL(a.currentIP, a.currentPort)
 					fmt.Println("📡 Updating URL to:", newURL)
 					a.safeEmit("url_changed", newURL)
 				}
@@ -1,5 +1,29 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {beamsync} from '../models';
+import {main} from '../models';
+
+export function ChooseSaveFolder():Promise<string>;
+
+export function ClearHistory():Promise<string>;
+
+export function ConfirmStop():Promise<boolean>;
+
+export function DiscoverPeers():Promise<Array<beamsync.Peer>>;
+
+export function GetActiveTransfers():Promise<Array<beamsync.Transfer>>;
+
+export function GetCertificateFingerprint():Promise<string>;
+
+export function GetDevices():Promise<Array<beamsync.Device>>;
+
+export function GetPairingPIN():Promise<string>;
+
+export function GetSettings():Promise<main.Settings>;
+
+export function ListHistory():Promise<Array<beamsync.HistoryEntry>>;
+
+export function OfferFileToDevice(arg1:string):Promise<string>;
 
 export function OpenFile(arg1:string):Promise<string>;
 
@@ -7,12 +31,28 @@ export function PlaySound(arg1:string):Promise<void>;
 
 export function ResetApp():Promise<void>;
 
+export function RespondToRequest(arg1:string,arg2:boolean):Promise<string>;
+
+export function RevealHistoryFile(arg1:string):Promise<string>;
+
+export function SearchHistory(arg1:string):Promise<Array<beamsync.HistoryEntry>>;
+
+export function SendToPeer(arg1:string,arg2:string):Promise<string>;
+
+export function SetApprovalMode(arg1:boolean):Promise<void>;
+
+export function SetSecureMode(arg1:boolean):Promise<void>;
+
 export function StartReceiver():Promise<string>;
 
 export function StartReceiverDefault():Promise<string>;
 
 export function StartSender():Promise<string>;
 
+export function StartSenderFolder():Promise<string>;
+
 export function StopReceiver():Promise<string>;
 
 export function StopSender():Promise<string>;
+
+export function UpdateSettings(arg1:main.Settings):Promise<string>;
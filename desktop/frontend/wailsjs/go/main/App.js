@@ -2,6 +2,50 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ChooseSaveFolder() {
+  return window['go']['main']['App']['ChooseSaveFolder']();
+}
+
+export function ClearHistory() {
+  return window['go']['main']['App']['ClearHistory']();
+}
+
+export function ConfirmStop() {
+  return window['go']['main']['App']['ConfirmStop']();
+}
+
+export function DiscoverPeers() {
+  return window['go']['main']['App']['DiscoverPeers']();
+}
+
+export function GetActiveTransfers() {
+  return window['go']['main']['App']['GetActiveTransfers']();
+}
+
+export function GetCertificateFingerprint() {
+  return window['go']['main']['App']['GetCertificateFingerprint']();
+}
+
+export function GetDevices() {
+  return window['go']['main']['App']['GetDevices']();
+}
+
+export function GetPairingPIN() {
+  return window['go']['main']['App']['GetPairingPIN']();
+}
+
+export function GetSettings() {
+  return window['go']['main']['App']['GetSettings']();
+}
+
+export function ListHistory() {
+  return window['go']['main']['App']['ListHistory']();
+}
+
+export function OfferFileToDevice(arg1) {
+  return window['go']['main']['App']['OfferFileToDevice'](arg1);
+}
+
 export function OpenFile(arg1) {
   return window['go']['main']['App']['OpenFile'](arg1);
 }
@@ -14,6 +58,30 @@ export function ResetApp() {
   return window['go']['main']['App']['ResetApp']();
 }
 
+export function RespondToRequest(arg1, arg2) {
+  return window['go']['main']['App']['RespondToRequest'](arg1, arg2);
+}
+
+export function RevealHistoryFile(arg1) {
+  return window['go']['main']['App']['RevealHistoryFile'](arg1);
+}
+
+export function SearchHistory(arg1) {
+  return window['go']['main']['App']['SearchHistory'](arg1);
+}
+
+export function SendToPeer(arg1, arg2) {
+  return window['go']['main']['App']['SendToPeer'](arg1, arg2);
+}
+
+export function SetApprovalMode(arg1) {
+  return window['go']['main']['App']['SetApprovalMode'](arg1);
+}
+
+export function SetSecureMode(arg1) {
+  return window['go']['main']['App']['SetSecureMode'](arg1);
+}
+
 export function StartReceiver() {
   return window['go']['main']['App']['StartReceiver']();
 }
@@ -26,6 +94,10 @@ export function StartSender() {
   return window['go']['main']['App']['StartSender']();
 }
 
+export function StartSenderFolder() {
+  return window['go']['main']['App']['StartSenderFolder']();
+}
+
 export function StopReceiver() {
   return window['go']['main']['App']['StopReceiver']();
 }
@@ -33,3 +105,7 @@ export function StopReceiver() {
 export function StopSender() {
   return window['go']['main']['App']['StopSender']();
 }
+
+export function UpdateSettings(arg1) {
+  return window['go']['main']['App']['UpdateSettings'](arg1);
+}
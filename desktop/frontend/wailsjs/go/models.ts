@@ -0,0 +1,249 @@
+export namespace beamsync {
+
+	export class AutoAcceptRules {
+	    ips: string[];
+	    maxBytes: number;
+
+	    static createFrom(source: any = {}) {
+	        return new AutoAcceptRules(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ips = source["ips"];
+	        this.maxBytes = source["maxBytes"];
+	    }
+	}
+
+	export class Device {
+	    id: string;
+	    name: string;
+	    ip: string;
+	    userAgent: string;
+	    role: string;
+	    // Go type: time
+	    connectedAt: any;
+	    // Go type: time
+	    lastSeen: any;
+
+	    static createFrom(source: any = {}) {
+	        return new Device(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.ip = source["ip"];
+	        this.userAgent = source["userAgent"];
+	        this.role = source["role"];
+	        this.connectedAt = this.convertValues(source["connectedAt"], null);
+	        this.lastSeen = this.convertValues(source["lastSeen"], null);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class HistoryEntry {
+	    id: string;
+	    direction: string;
+	    name: string;
+	    path?: string;
+	    size: number;
+	    sha256?: string;
+	    device: string;
+	    // Go type: time
+	    startedAt: any;
+	    // Go type: time
+	    endedAt: any;
+	    outcome: string;
+	    error?: string;
+
+	    static createFrom(source: any = {}) {
+	        return new HistoryEntry(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.direction = source["direction"];
+	        this.name = source["name"];
+	        this.path = source["path"];
+	        this.size = source["size"];
+	        this.sha256 = source["sha256"];
+	        this.device = source["device"];
+	        this.startedAt = this.convertValues(source["startedAt"], null);
+	        this.endedAt = this.convertValues(source["endedAt"], null);
+	        this.outcome = source["outcome"];
+	        this.error = source["error"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class Peer {
+	    id: string;
+	    name: string;
+	    role: string;
+	    address: string;
+	    port: number;
+	    scheme: string;
+	    fingerprint: string;
+
+	    static createFrom(source: any = {}) {
+	        return new Peer(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.role = source["role"];
+	        this.address = source["address"];
+	        this.port = source["port"];
+	        this.scheme = source["scheme"];
+	        this.fingerprint = source["fingerprint"];
+	    }
+	}
+
+	export class Transfer {
+	    id: string;
+	    name: string;
+	    direction: string;
+	    device: string;
+	    // Go type: time
+	    startedAt: any;
+	    resumable: boolean;
+
+	    static createFrom(source: any = {}) {
+	        return new Transfer(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.direction = source["direction"];
+	        this.device = source["device"];
+	        this.startedAt = this.convertValues(source["startedAt"], null);
+	        this.resumable = source["resumable"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace main {
+
+	export class PortRange {
+	    first: number;
+	    last: number;
+
+	    static createFrom(source: any = {}) {
+	        return new PortRange(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.first = source["first"];
+	        this.last = source["last"];
+	    }
+	}
+
+	export class Settings {
+	    version: number;
+	    saveDir: string;
+	    receiverPorts: PortRange;
+	    senderPorts: PortRange;
+	    collision: string;
+	    askApproval: boolean;
+	    autoAccept: beamsync.AutoAcceptRules;
+	    sounds: boolean;
+	    secureMode: boolean;
+
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.saveDir = source["saveDir"];
+	        this.receiverPorts = this.convertValues(source["receiverPorts"], PortRange);
+	        this.senderPorts = this.convertValues(source["senderPorts"], PortRange);
+	        this.collision = source["collision"];
+	        this.askApproval = source["askApproval"];
+	        this.autoAccept = this.convertValues(source["autoAccept"], beamsync.AutoAcceptRules);
+	        this.sounds = source["sounds"];
+	        this.secureMode = source["secureMode"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
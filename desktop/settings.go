@@ -0,0 +1,212 @@
+package main
+
+import (
+	"beamsync"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// settingsVersion is the layout of settings.json. When it changes, bump it
+// and append the step from the previous layout to settingsMigrations.
+const settingsVersion = 1
+
+// Settings are the preferences kept in settings.json in the config directory
+type Settings struct {
+	Version int `json:"version"`
+	// SaveDir is where the receiver saves files when started without asking
+	SaveDir string `json:"saveDir"`
+	// ReceiverPorts and SenderPorts are scanned every beamsync.PortStep
+	// ports, so ranges starting on an even and an odd port can overlap
+	ReceiverPorts PortRange                `json:"receiverPorts"`
+	SenderPorts   PortRange                `json:"senderPorts"`
+	Collision     beamsync.CollisionPolicy `json:"collision"`
+	// AskApproval holds incoming transfers until accepted, except those
+	// AutoAccept lets through
+	AskApproval bool                     `json:"askApproval"`
+	AutoAccept  beamsync.AutoAcceptRules `json:"autoAccept"`
+	Sounds      bool                     `json:"sounds"`
+	// SecureMode serves HTTPS with the certificate kept next to this file
+	SecureMode bool `json:"secureMode"`
+}
+
+// PortRange is the first and last port a server may listen on
+type PortRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// overlaps reports whether servers scanning p and o could take the same port
+func (p PortRange) overlaps(o PortRange) bool {
+	return beamsync.PortsCollide(p.First, p.Last, o.First, o.Last)
+}
+
+// defaultSettings matches what the app did before it had a settings file
+func defaultSettings() Settings {
+	saveDir, _ := filepath.Abs("received_files")
+	if home, err := os.UserHomeDir(); err == nil {
+		saveDir = filepath.Join(home, "Downloads", "BeamSync")
+	}
+	return Settings{
+		Version:       settingsVersion,
+		SaveDir:       saveDir,
+		ReceiverPorts: PortRange{beamsync.DefaultReceiverPort, beamsync.DefaultReceiverPort + 98},
+		SenderPorts:   PortRange{beamsync.DefaultSenderPort, beamsync.DefaultSenderPort + 98},
+		Collision:     beamsync.CollisionRename,
+		AutoAccept:    beamsync.AutoAcceptRules{IPs: []string{}},
+		Sounds:        true,
+	}
+}
+
+// Validate reports every problem with the settings at once
+func (s Settings) Validate() error {
+	var errs []error
+	if s.SaveDir == "" {
+		errs = append(errs, errors.New("save folder is empty"))
+	} else if !filepath.IsAbs(s.SaveDir) {
+		errs = append(errs, fmt.Errorf("save folder %q is not an absolute path", s.SaveDir))
+	}
+	for _, r := range []struct {
+		name  string
+		ports PortRange
+	}{{"receiver", s.ReceiverPorts}, {"sender", s.SenderPorts}} {
+		if r.ports.First < 1024 || r.ports.Last > 65535 || r.ports.First > r.ports.Last {
+			errs = append(errs, fmt.Errorf("%s ports must be a range within 1024-65535, got %d-%d",
+				r.name, r.ports.First, r.ports.Last))
+		}
+	}
+	if s.ReceiverPorts.overlaps(s.SenderPorts) {
+		errs = append(errs, errors.New("receiver and sender ports overlap; start one range on an odd port"))
+	}
+	if !s.Collision.Valid() {
+		errs = append(errs, fmt.Errorf("unknown collision policy %q", s.Collision))
+	}
+	for _, ip := range s.AutoAccept.IPs {
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("auto-accept address %q is not an IP", ip))
+		}
+	}
+	if s.AutoAccept.MaxBytes < 0 {
+		errs = append(errs, errors.New("auto-accept size limit is negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// settingsMigrations[v] upgrades a version v file, decoded as a map, to v+1
+var settingsMigrations = []func(raw map[string]any){
+	// 0: files written by hand before the version field; keys match version 1
+	func(raw map[string]any) {},
+}
+
+// decodeSettings migrates data to the current version and fills anything
+// it leaves out from the defaults
+func decodeSettings(data []byte) (Settings, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Settings{}, err
+	}
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > settingsVersion {
+		return Settings{}, fmt.Errorf("settings version %d is newer than this app supports (%d)", version, settingsVersion)
+	}
+	for ; version < settingsVersion; version++ {
+		fmt.Printf("🔧 Migrating settings from version %d\n", version)
+		settingsMigrations[version](raw)
+	}
+	raw["version"] = settingsVersion
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return Settings{}, err
+	}
+	s := defaultSettings()
+	if err := json.Unmarshal(migrated, &s); err != nil {
+		return Settings{}, err
+	}
+	return s, s.Validate()
+}
+
+// settingsPath is settings.json in the BeamSync config directory
+func settingsPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "beamsync", "settings.json"), nil
+}
+
+// loadSettings reads the settings file, creating it with the defaults on
+// first run. A file that can't be used is set aside as settings.json.bad
+// and replaced, except one from a newer version, which is left for it.
+func loadSettings(path string) Settings {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s := defaultSettings()
+		if err := saveSettings(path, s); err != nil {
+			fmt.Println("⚠️ Failed to write default settings:", err)
+		}
+		return s
+	}
+	if err != nil {
+		fmt.Println("⚠️ Failed to read settings, using defaults:", err)
+		return defaultSettings()
+	}
+
+	s, err := decodeSettings(data)
+	if err == nil {
+		fmt.Println("⚙️ Loaded settings from", path)
+		return s
+	}
+	fmt.Println("⚠️ Invalid settings, using defaults:", err)
+	var raw struct {
+		Version int `json:"version"`
+	}
+	if json.Unmarshal(data, &raw) == nil && raw.Version > settingsVersion {
+		return defaultSettings()
+	}
+	if err := os.Rename(path, path+".bad"); err != nil {
+		fmt.Println("⚠️ Failed to set aside invalid settings:", err)
+		return defaultSettings()
+	}
+	s = defaultSettings()
+	if err := saveSettings(path, s); err != nil {
+		fmt.Println("⚠️ Failed to write default settings:", err)
+	}
+	return s
+}
+
+// saveSettings writes s through a temporary file so a crash can't leave
+// half a file behind
+func saveSettings(path string, s Settings) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".settings-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
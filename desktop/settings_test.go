@@ -0,0 +1,184 @@
+package main
+
+import (
+	"beamsync"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	if err := defaultSettings().Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		change func(s *Settings)
+		want   string
+	}{
+		{"empty save folder", func(s *Settings) { s.SaveDir = "" }, "save folder is empty"},
+		{"relative save folder", func(s *Settings) { s.SaveDir = "Downloads" }, "not an absolute path"},
+		{"privileged ports", func(s *Settings) { s.ReceiverPorts = PortRange{80, 180} }, "receiver ports"},
+		{"ports past 65535", func(s *Settings) { s.SenderPorts = PortRange{65000, 65600} }, "sender ports"},
+		{"backwards range", func(s *Settings) { s.SenderPorts = PortRange{5000, 4000} }, "sender ports"},
+		{"same parity overlap", func(s *Settings) { s.SenderPorts = PortRange{3050, 3200} }, "overlap"},
+		{"unknown policy", func(s *Settings) { s.Collision = "append" }, "collision policy"},
+		{"bad address", func(s *Settings) { s.AutoAccept.IPs = []string{"phone"} }, "not an IP"},
+		{"negative limit", func(s *Settings) { s.AutoAccept.MaxBytes = -1 }, "negative"},
+	} {
+		s := defaultSettings()
+		c.change(&s)
+		if err := s.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error mentioning %q", c.name, err, c.want)
+		}
+	}
+
+	// Interleaved ranges never share a port
+	s := defaultSettings()
+	s.ReceiverPorts = PortRange{3000, 3098}
+	s.SenderPorts = PortRange{3001, 3099}
+	if err := s.Validate(); err != nil {
+		t.Errorf("odd and even ranges: %v", err)
+	}
+
+	s = defaultSettings()
+	s.SaveDir = ""
+	s.Collision = "append"
+	if err := s.Validate(); err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("two problems reported as %q", err)
+	}
+}
+
+func TestDecodeSettingsMigrates(t *testing.T) {
+	saveDir := filepath.Join(t.TempDir(), "Inbox")
+	// Written by hand before settings.json had a version
+	data := `{"saveDir": ` + quote(saveDir) + `, "sounds": false, "collision": "skip"}`
+
+	got, err := decodeSettings([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultSettings()
+	want.SaveDir = saveDir
+	want.Sounds = false
+	want.Collision = beamsync.CollisionSkip
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeSettingsRejects(t *testing.T) {
+	for _, data := range []string{
+		`{"version": 99}`,
+		`{"version": 1, "collision": "append"}`,
+		`not json`,
+	} {
+		if _, err := decodeSettings([]byte(data)); err == nil {
+			t.Errorf("decodeSettings(%s) accepted", data)
+		}
+	}
+}
+
+func TestSaveSettingsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "beamsync", "settings.json")
+	s := defaultSettings()
+	s.SecureMode = true
+	s.AutoAccept = beamsync.AutoAcceptRules{IPs: []string{"192.168.1.20"}, MaxBytes: 1 << 20}
+	for i := 0; i < 2; i++ {
+		if err := saveSettings(path, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := loadSettings(path); !reflect.DeepEqual(got, s) {
+		t.Errorf("loaded %+v, want %+v", got, s)
+	}
+	assertNoTempFiles(t, filepath.Dir(path))
+}
+
+// TestSaveSettingsFailureCleansUp checks a save that can't replace the
+// file leaves neither it nor a temporary file changed behind.
+func TestSaveSettingsFailureCleansUp(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveSettings(path, defaultSettings()); err == nil {
+		t.Fatal("saved over a directory")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestLoadSettings(t *testing.T) {
+	t.Run("first run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		if got := loadSettings(path); !reflect.DeepEqual(got, defaultSettings()) {
+			t.Errorf("loaded %+v, want the defaults", got)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("defaults not written: %v", err)
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		writeFile(t, path, `{"version": 1, "receiverPorts": {"first": 80, "last": 90}}`)
+		if got := loadSettings(path); !reflect.DeepEqual(got, defaultSettings()) {
+			t.Errorf("loaded %+v, want the defaults", got)
+		}
+		if data, _ := os.ReadFile(path + ".bad"); !strings.Contains(string(data), `"first": 80`) {
+			t.Errorf("invalid file not set aside, .bad holds %q", data)
+		}
+		if _, err := decodeSettings(readFile(t, path)); err != nil {
+			t.Errorf("replacement is unusable: %v", err)
+		}
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		newer := `{"version": 99, "saveDir": "/elsewhere"}`
+		writeFile(t, path, newer)
+		if got := loadSettings(path); !reflect.DeepEqual(got, defaultSettings()) {
+			t.Errorf("loaded %+v, want the defaults", got)
+		}
+		if data := readFile(t, path); string(data) != newer {
+			t.Errorf("newer file replaced with %q", data)
+		}
+		if _, err := os.Stat(path + ".bad"); !os.IsNotExist(err) {
+			t.Error("newer file set aside")
+		}
+	})
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `\`, `\\`) + `"`
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, ".settings-*.tmp"))
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}